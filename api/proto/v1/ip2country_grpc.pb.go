@@ -0,0 +1,206 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.27.1
+// source: api/proto/v1/ip2country.proto
+
+package v1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	IP2Country_Lookup_FullMethodName       = "/ip2country.v1.IP2Country/Lookup"
+	IP2Country_BatchLookup_FullMethodName  = "/ip2country.v1.IP2Country/BatchLookup"
+	IP2Country_StreamLookup_FullMethodName = "/ip2country.v1.IP2Country/StreamLookup"
+)
+
+// IP2CountryClient is the client API for IP2Country service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// IP2Country translates IP addresses to their country and city.
+type IP2CountryClient interface {
+	// Lookup returns the location of an IP address.
+	Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error)
+	// BatchLookup returns the location of several IP addresses, counting as
+	// one request per address against the rate limits.
+	BatchLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (*BatchLookupResponse, error)
+	// StreamLookup returns the location of every IP address sent on the
+	// stream, in order, counting as one request per address against the rate limits.
+	StreamLookup(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[LookupRequest, LookupResult], error)
+}
+
+type iP2CountryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIP2CountryClient(cc grpc.ClientConnInterface) IP2CountryClient {
+	return &iP2CountryClient{cc}
+}
+
+func (c *iP2CountryClient) Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LookupResponse)
+	err := c.cc.Invoke(ctx, IP2Country_Lookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iP2CountryClient) BatchLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (*BatchLookupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchLookupResponse)
+	err := c.cc.Invoke(ctx, IP2Country_BatchLookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iP2CountryClient) StreamLookup(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[LookupRequest, LookupResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &IP2Country_ServiceDesc.Streams[0], IP2Country_StreamLookup_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[LookupRequest, LookupResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IP2Country_StreamLookupClient = grpc.BidiStreamingClient[LookupRequest, LookupResult]
+
+// IP2CountryServer is the server API for IP2Country service.
+// All implementations must embed UnimplementedIP2CountryServer
+// for forward compatibility.
+//
+// IP2Country translates IP addresses to their country and city.
+type IP2CountryServer interface {
+	// Lookup returns the location of an IP address.
+	Lookup(context.Context, *LookupRequest) (*LookupResponse, error)
+	// BatchLookup returns the location of several IP addresses, counting as
+	// one request per address against the rate limits.
+	BatchLookup(context.Context, *BatchLookupRequest) (*BatchLookupResponse, error)
+	// StreamLookup returns the location of every IP address sent on the
+	// stream, in order, counting as one request per address against the rate limits.
+	StreamLookup(grpc.BidiStreamingServer[LookupRequest, LookupResult]) error
+	mustEmbedUnimplementedIP2CountryServer()
+}
+
+// UnimplementedIP2CountryServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIP2CountryServer struct{}
+
+func (UnimplementedIP2CountryServer) Lookup(context.Context, *LookupRequest) (*LookupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lookup not implemented")
+}
+func (UnimplementedIP2CountryServer) BatchLookup(context.Context, *BatchLookupRequest) (*BatchLookupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchLookup not implemented")
+}
+func (UnimplementedIP2CountryServer) StreamLookup(grpc.BidiStreamingServer[LookupRequest, LookupResult]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLookup not implemented")
+}
+func (UnimplementedIP2CountryServer) mustEmbedUnimplementedIP2CountryServer() {}
+func (UnimplementedIP2CountryServer) testEmbeddedByValue()                    {}
+
+// UnsafeIP2CountryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IP2CountryServer will
+// result in compilation errors.
+type UnsafeIP2CountryServer interface {
+	mustEmbedUnimplementedIP2CountryServer()
+}
+
+func RegisterIP2CountryServer(s grpc.ServiceRegistrar, srv IP2CountryServer) {
+	// If the following call pancis, it indicates UnimplementedIP2CountryServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&IP2Country_ServiceDesc, srv)
+}
+
+func _IP2Country_Lookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IP2CountryServer).Lookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IP2Country_Lookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IP2CountryServer).Lookup(ctx, req.(*LookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IP2Country_BatchLookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchLookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IP2CountryServer).BatchLookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IP2Country_BatchLookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IP2CountryServer).BatchLookup(ctx, req.(*BatchLookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IP2Country_StreamLookup_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IP2CountryServer).StreamLookup(&grpc.GenericServerStream[LookupRequest, LookupResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type IP2Country_StreamLookupServer = grpc.BidiStreamingServer[LookupRequest, LookupResult]
+
+// IP2Country_ServiceDesc is the grpc.ServiceDesc for IP2Country service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IP2Country_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ip2country.v1.IP2Country",
+	HandlerType: (*IP2CountryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lookup",
+			Handler:    _IP2Country_Lookup_Handler,
+		},
+		{
+			MethodName: "BatchLookup",
+			Handler:    _IP2Country_BatchLookup_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLookup",
+			Handler:       _IP2Country_StreamLookup_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "api/proto/v1/ip2country.proto",
+}
@@ -22,5 +22,7 @@ func main() {
 	}
 
 	// Run
-	app.Run(cfg)
+	if err := app.Run(cfg); err != nil {
+		log.Fatalf("App error: %s", err)
+	}
 }
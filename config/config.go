@@ -2,34 +2,89 @@ package config
 
 import (
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+var (
+	// rateLimiterAlgorithms are the values accepted by RateLimiter.Algorithm.
+	rateLimiterAlgorithms = []string{"token_bucket", "sliding_window_log", "sliding_window_counter", "gcra"}
+	// redisModes are the values accepted by RateLimiter.RedisMode.
+	redisModes = []string{"standalone", "sentinel", "cluster"}
+)
+
 type (
 	// Config -.
 	Config struct {
 		App             `yaml:"app"`
 		HTTP            `yaml:"http"`
+		HTTPCache       `yaml:"httpCache"`
+		GRPC            `yaml:"grpc"`
 		Log             `yaml:"logger"`
 		Cache           `yaml:"cache"`
 		Repository      `yaml:"repository"`
 		DiskRepository  `yaml:"diskRepository"`
 		MongoRepository `yaml:"mongoRepository"`
 		RateLimiter     `yaml:"rateLimiter"`
+		APIKeys         `yaml:"apiKeys"`
+		IPFilter        `yaml:"ipFilter"`
+		GeoPolicies     `yaml:"geoPolicies"`
+		Health          `yaml:"health"`
+		Admin           `yaml:"admin"`
+		Auth            `yaml:"auth"`
 	}
 
 	// App -.
 	App struct {
-		Name    string `yaml:"name" env:"APP_NAME" validate:"required"`
-		Version string `yaml:"version" env:"APP_VERSION" validate:"required"`
+		Name        string        `yaml:"name" env:"APP_NAME" validate:"required"`
+		Version     string        `yaml:"version" env:"APP_VERSION" validate:"required"`
+		StopTimeout time.Duration `yaml:"stopTimeout" env:"APP_STOP_TIMEOUT" env-default:"25s" validate:"gt=0"`
 	}
 
 	// HTTP -.
 	HTTP struct {
-		Port string `yaml:"port" env:"HTTP_PORT" validate:"required"`
+		Host              string        `yaml:"host" env:"HTTP_HOST"`
+		Port              string        `yaml:"port" env:"HTTP_PORT" validate:"required"`
+		H2C               bool          `yaml:"h2c" env:"HTTP_H2C"`
+		UnixSocket        string        `yaml:"unixSocket" env:"HTTP_UNIX_SOCKET"`
+		ReadTimeout       time.Duration `yaml:"readTimeout" env:"HTTP_READ_TIMEOUT" env-default:"5s" validate:"gte=0"`
+		ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"HTTP_READ_HEADER_TIMEOUT" env-default:"2s" validate:"gte=0"`
+		WriteTimeout      time.Duration `yaml:"writeTimeout" env:"HTTP_WRITE_TIMEOUT" env-default:"5s" validate:"gte=0"`
+		IdleTimeout       time.Duration `yaml:"idleTimeout" env:"HTTP_IDLE_TIMEOUT" env-default:"60s" validate:"gte=0"`
+		MaxHeaderBytes    int           `yaml:"maxHeaderBytes" env:"HTTP_MAX_HEADER_BYTES" env-default:"1048576" validate:"gt=0"`
+		DisableKeepAlives bool          `yaml:"disableKeepAlives" env:"HTTP_DISABLE_KEEP_ALIVES"`
+		MaxConns          int           `yaml:"maxConns" env:"HTTP_MAX_CONNS" validate:"gte=0"`
+		MaxInFlight       int           `yaml:"maxInFlight" env:"HTTP_MAX_IN_FLIGHT" validate:"gte=0"`
+		TrustedProxies    []string      `yaml:"trustedProxies" env:"HTTP_TRUSTED_PROXIES" validate:"dive,ip|cidr"`
+		ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" env:"HTTP_SHUTDOWN_TIMEOUT" env-default:"3s" validate:"gt=0"`
+		TLS               TLS           `yaml:"tls"`
+	}
+
+	// TLS -.
+	TLS struct {
+		CertFile       string        `yaml:"certFile" env:"HTTP_TLS_CERT_FILE" validate:"required_with=KeyFile"`
+		KeyFile        string        `yaml:"keyFile" env:"HTTP_TLS_KEY_FILE" validate:"required_with=CertFile"`
+		Port           string        `yaml:"port" env:"HTTP_TLS_PORT"`
+		MinVersion     string        `yaml:"minVersion" env:"HTTP_TLS_MIN_VERSION" env-default:"1.2" validate:"oneof=1.2 1.3"`
+		CipherSuites   []string      `yaml:"cipherSuites" env:"HTTP_TLS_CIPHER_SUITES"`
+		ClientCAFile   string        `yaml:"clientCAFile" env:"HTTP_TLS_CLIENT_CA_FILE"`
+		ClientAuth     string        `yaml:"clientAuth" env:"HTTP_TLS_CLIENT_AUTH" env-default:"optional" validate:"oneof=optional required"`
+		ReloadInterval time.Duration `yaml:"reloadInterval" env:"HTTP_TLS_RELOAD_INTERVAL" env-default:"1m"`
+	}
+
+	// HTTPCache -.
+	HTTPCache struct {
+		MaxAge         time.Duration `yaml:"maxAge" env:"HTTP_CACHE_MAX_AGE" env-default:"1h" validate:"gte=0"`
+		DatasetVersion string        `yaml:"datasetVersion" env:"HTTP_CACHE_DATASET_VERSION"`
+	}
+
+	// GRPC -.
+	GRPC struct {
+		Port            string        `yaml:"port" env:"GRPC_PORT" env-default:"8081" validate:"required"`
+		ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"GRPC_SHUTDOWN_TIMEOUT" env-default:"3s" validate:"gt=0"`
 	}
 
 	// Log -.
@@ -38,7 +93,8 @@ type (
 	}
 
 	Cache struct {
-		Size int `yaml:"size" env:"CACHE_SIZE" validate:"required"`
+		Size      int      `yaml:"size" env:"CACHE_SIZE" validate:"required"`
+		WarmUpIPs []string `yaml:"warmUpIPs" env:"CACHE_WARM_UP_IPS" validate:"dive,ip"`
 	}
 
 	Repository struct {
@@ -55,14 +111,156 @@ type (
 		Collection string `yaml:"collection" env:"MONGO_REPOSITORY_COLLECTION"`
 	}
 
+	// RateLimiter -.
 	RateLimiter struct {
-		Type          string        `yaml:"type" env:"RATE_LIMITER_TYPE" validate:"required,oneof=local distributed"`
-		MaxRequests   int           `yaml:"maxRequests" env:"RATE_LIMITER_MAX_REQUESTS" env-default:"100"`
-		UserRequests  int           `yaml:"userRequests" env:"RATE_LIMITER_USER_REQUESTS" env-default:"5"`
-		Interval      time.Duration `yaml:"interval" env:"RATE_LIMITER_INTERVAL" env-default:"1s"`
-		BucketTTL     time.Duration `yaml:"bucketTTL" env:"RATE_LIMITER_BUCKET_TTL" env-default:"10s"`
-		CleanInterval time.Duration `yaml:"cleanInterval" env:"RATE_LIMITER_CLEAN_INTERVAL" env-default:"10s"`
-		RedisAddr     string        `yaml:"redisAddr" env:"RATE_LIMITER_REDIS_ADDR" env-default:"localhost:6379"`
+		Type              string         `yaml:"type" env:"RATE_LIMITER_TYPE" validate:"required,oneof=local distributed hybrid"`
+		Algorithm         string         `yaml:"algorithm" env:"RATE_LIMITER_ALGORITHM" env-default:"token_bucket" validate:"algorithm"`
+		MaxRequests       int            `yaml:"maxRequests" env:"RATE_LIMITER_MAX_REQUESTS" env-default:"100" validate:"gt=0"`
+		UserRequests      int            `yaml:"userRequests" env:"RATE_LIMITER_USER_REQUESTS" env-default:"5" validate:"gt=0"`
+		Burst             int            `yaml:"burst" env:"RATE_LIMITER_BURST"`
+		UserBurst         int            `yaml:"userBurst" env:"RATE_LIMITER_USER_BURST"`
+		Interval          time.Duration  `yaml:"interval" env:"RATE_LIMITER_INTERVAL" env-default:"1s" validate:"gt=0"`
+		BucketTTL         time.Duration  `yaml:"bucketTTL" env:"RATE_LIMITER_BUCKET_TTL" env-default:"10s"`
+		CleanInterval     time.Duration  `yaml:"cleanInterval" env:"RATE_LIMITER_CLEAN_INTERVAL" env-default:"10s"`
+		SnapshotFile      string         `yaml:"snapshotFile" env:"RATE_LIMITER_SNAPSHOT_FILE"`
+		RedisAddr         string         `yaml:"redisAddr" env:"RATE_LIMITER_REDIS_ADDR" env-default:"localhost:6379"`
+		RedisMode         string         `yaml:"redisMode" env:"RATE_LIMITER_REDIS_MODE" env-default:"standalone" validate:"redisMode"`
+		RedisAddrs        []string       `yaml:"redisAddrs" env:"RATE_LIMITER_REDIS_ADDRS"`
+		RedisMasterName   string         `yaml:"redisMasterName" env:"RATE_LIMITER_REDIS_MASTER_NAME" validate:"required_if=RedisMode sentinel"`
+		RedisUsername     string         `yaml:"redisUsername" env:"RATE_LIMITER_REDIS_USERNAME"`
+		RedisPassword     string         `yaml:"redisPassword" env:"RATE_LIMITER_REDIS_PASSWORD"`
+		SentinelPassword  string         `yaml:"sentinelPassword" env:"RATE_LIMITER_REDIS_SENTINEL_PASSWORD"`
+		RedisDB           int            `yaml:"redisDB" env:"RATE_LIMITER_REDIS_DB"`
+		RedisTLS          bool           `yaml:"redisTLS" env:"RATE_LIMITER_REDIS_TLS"`
+		RedisCAFile       string         `yaml:"redisCAFile" env:"RATE_LIMITER_REDIS_CA_FILE"`
+		RedisServerName   string         `yaml:"redisServerName" env:"RATE_LIMITER_REDIS_SERVER_NAME"`
+		RedisPoolSize     int            `yaml:"redisPoolSize" env:"RATE_LIMITER_REDIS_POOL_SIZE"`
+		RedisDialTimeout  time.Duration  `yaml:"redisDialTimeout" env:"RATE_LIMITER_REDIS_DIAL_TIMEOUT"`
+		RedisReadTimeout  time.Duration  `yaml:"redisReadTimeout" env:"RATE_LIMITER_REDIS_READ_TIMEOUT"`
+		RedisWriteTimeout time.Duration  `yaml:"redisWriteTimeout" env:"RATE_LIMITER_REDIS_WRITE_TIMEOUT"`
+		OnFailure         string         `yaml:"onFailure" env:"RATE_LIMITER_ON_FAILURE" env-default:"local" validate:"oneof=open closed local"`
+		BreakerThreshold  int            `yaml:"breakerThreshold" env:"RATE_LIMITER_BREAKER_THRESHOLD" env-default:"5" validate:"gt=0"`
+		BreakerCooldown   time.Duration  `yaml:"breakerCooldown" env:"RATE_LIMITER_BREAKER_COOLDOWN" env-default:"10s"`
+		LeaseSize         int            `yaml:"leaseSize" env:"RATE_LIMITER_LEASE_SIZE" env-default:"10" validate:"gt=0"`
+		SyncInterval      time.Duration  `yaml:"syncInterval" env:"RATE_LIMITER_SYNC_INTERVAL" env-default:"100ms" validate:"gt=0"`
+		MaxWait           time.Duration  `yaml:"maxWait" env:"RATE_LIMITER_MAX_WAIT"`
+		MaxWaiters        int            `yaml:"maxWaiters" env:"RATE_LIMITER_MAX_WAITERS" env-default:"100" validate:"gt=0"`
+		Keys              []RateLimitKey `yaml:"keys" validate:"dive"`
+	}
+
+	// RateLimitKey -.
+	RateLimitKey struct {
+		Strategy   string        `yaml:"strategy" validate:"oneof=ip subnet apikey principal header"`
+		IPv4Prefix int           `yaml:"ipv4Prefix" validate:"max=32"`
+		IPv6Prefix int           `yaml:"ipv6Prefix" validate:"max=128"`
+		Header     string        `yaml:"header" validate:"required_if=Strategy header"`
+		Requests   int           `yaml:"requests" validate:"required"`
+		Burst      int           `yaml:"burst"`
+		Interval   time.Duration `yaml:"interval" validate:"required"`
+	}
+
+	// APIKeys -.
+	APIKeys struct {
+		Header     string    `yaml:"header" env:"API_KEYS_HEADER" env-default:"X-API-Key"`
+		QueryParam string    `yaml:"queryParam" env:"API_KEYS_QUERY_PARAM" env-default:"api_key"`
+		File       string    `yaml:"file" env:"API_KEYS_FILE"`
+		Tiers      []APITier `yaml:"tiers" validate:"dive"`
+		Keys       []APIKey  `yaml:"keys" validate:"dive"`
+	}
+
+	// APITier -.
+	APITier struct {
+		Name         string        `yaml:"name" validate:"required"`
+		Requests     int           `yaml:"requests" validate:"required"`
+		Burst        int           `yaml:"burst"`
+		Interval     time.Duration `yaml:"interval" validate:"required"`
+		DailyQuota   int           `yaml:"dailyQuota"`
+		MonthlyQuota int           `yaml:"monthlyQuota"`
+	}
+
+	// APIKey -.
+	APIKey struct {
+		Name string `yaml:"name" json:"name" validate:"required"`
+		// Key is the key itself, Hash its hex encoded SHA-256 digest, one of which is set
+		Key   string   `yaml:"key" json:"key" validate:"required_without=Hash"`
+		Hash  string   `yaml:"hash" json:"hash" validate:"required_without=Key,omitempty,len=64,hexadecimal"`
+		Tier  string   `yaml:"tier" json:"tier" validate:"required"`
+		Roles []string `yaml:"roles" json:"roles"`
+	}
+
+	// IPFilter -.
+	IPFilter struct {
+		Allow          []string      `yaml:"allow" env:"IP_FILTER_ALLOW" validate:"dive,cidr|ip"`
+		Deny           []string      `yaml:"deny" env:"IP_FILTER_DENY" validate:"dive,cidr|ip"`
+		File           string        `yaml:"file" env:"IP_FILTER_FILE"`
+		ReloadInterval time.Duration `yaml:"reloadInterval" env:"IP_FILTER_RELOAD_INTERVAL" env-default:"30s"`
+		AllowRequests  int           `yaml:"allowRequests" env:"IP_FILTER_ALLOW_REQUESTS"`
+		AllowBurst     int           `yaml:"allowBurst" env:"IP_FILTER_ALLOW_BURST"`
+		AllowInterval  time.Duration `yaml:"allowInterval" env:"IP_FILTER_ALLOW_INTERVAL" env-default:"1s"`
+	}
+
+	// GeoPolicies -.
+	GeoPolicies struct {
+		Policies []GeoPolicy `yaml:"policies" validate:"dive"`
+	}
+
+	// GeoPolicy -.
+	GeoPolicy struct {
+		Name      string        `yaml:"name" validate:"required"`
+		Countries []string      `yaml:"countries" validate:"required,dive,required"`
+		Action    string        `yaml:"action" validate:"oneof=limit block"`
+		Requests  int           `yaml:"requests" validate:"required_if=Action limit"`
+		Burst     int           `yaml:"burst"`
+		Interval  time.Duration `yaml:"interval" validate:"required_if=Action limit"`
+	}
+
+	// Health -.
+	Health struct {
+		CheckTimeout  time.Duration `yaml:"checkTimeout" env:"HEALTH_CHECK_TIMEOUT" env-default:"2s" validate:"gt=0"`
+		ShutdownDelay time.Duration `yaml:"shutdownDelay" env:"HEALTH_SHUTDOWN_DELAY" env-default:"5s" validate:"gte=0"`
+	}
+
+	// Admin -.
+	Admin struct {
+		Token string `yaml:"token" env:"ADMIN_TOKEN"`
+		Port  string `yaml:"port" env:"ADMIN_PORT" validate:"required_if=Pprof true"`
+		Pprof bool   `yaml:"pprof" env:"ADMIN_PPROF"`
+	}
+
+	// Auth -.
+	Auth struct {
+		Routes AuthRoutes `yaml:"routes"`
+		JWT    JWT        `yaml:"jwt"`
+		MTLS   MTLS       `yaml:"mtls"`
+	}
+
+	// AuthRoutes holds the policy of each group of routes: public, authenticated, or the role required.
+	AuthRoutes struct {
+		Lookup  string `yaml:"lookup" env:"AUTH_LOOKUP_POLICY" env-default:"public"`
+		Metrics string `yaml:"metrics" env:"AUTH_METRICS_POLICY" env-default:"metrics"`
+		Admin   string `yaml:"admin" env:"AUTH_ADMIN_POLICY" env-default:"admin"`
+	}
+
+	// JWT -.
+	JWT struct {
+		JWKSFile        string        `yaml:"jwksFile" env:"AUTH_JWT_JWKS_FILE" validate:"excluded_with=JWKSURL"`
+		JWKSURL         string        `yaml:"jwksURL" env:"AUTH_JWT_JWKS_URL" validate:"omitempty,url"`
+		RefreshInterval time.Duration `yaml:"refreshInterval" env:"AUTH_JWT_REFRESH_INTERVAL" env-default:"1h" validate:"gt=0"`
+		Issuer          string        `yaml:"issuer" env:"AUTH_JWT_ISSUER" validate:"required_with=JWKSFile JWKSURL"`
+		Audience        string        `yaml:"audience" env:"AUTH_JWT_AUDIENCE" validate:"required_with=JWKSFile JWKSURL"`
+		RolesClaim      string        `yaml:"rolesClaim" env:"AUTH_JWT_ROLES_CLAIM" env-default:"roles"`
+		Leeway          time.Duration `yaml:"leeway" env:"AUTH_JWT_LEEWAY" env-default:"30s"`
+	}
+
+	// MTLS -.
+	MTLS struct {
+		Identities []MTLSIdentity `yaml:"identities" validate:"dive"`
+	}
+
+	// MTLSIdentity grants roles to the client certificates of a subject common name.
+	MTLSIdentity struct {
+		Name  string   `yaml:"name" validate:"required"`
+		Roles []string `yaml:"roles"`
 	}
 )
 
@@ -79,9 +277,23 @@ func NewConfig(path string) (*Config, error) {
 	}
 
 	validate := validator.New()
+	if err := validate.RegisterValidation("algorithm", oneOf(rateLimiterAlgorithms)); err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
+	if err := validate.RegisterValidation("redisMode", oneOf(redisModes)); err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
+
 	if err := validate.Struct(cfg); err != nil {
 		return nil, fmt.Errorf("validation error: %w", err)
 	}
 
 	return cfg, nil
 }
+
+// oneOf validates that a field is one of values.
+func oneOf(values []string) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		return slices.Contains(values, fl.Field().String())
+	}
+}
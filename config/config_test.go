@@ -78,6 +78,7 @@ rateLimiter:
 	assert.Equal(t, 10, cfg.RateLimiter.UserRequests)
 	assert.Equal(t, 2*time.Second, cfg.RateLimiter.Interval)
 	assert.Equal(t, "localhost:6379", cfg.RateLimiter.RedisAddr)
+	assert.Equal(t, 3*time.Second, cfg.GRPC.ShutdownTimeout)
 }
 
 func TestInvalidRepositoryType(t *testing.T) {
@@ -123,3 +124,187 @@ rateLimiter:
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "validation error")
 }
+
+func TestInvalidRateLimiterAlgorithm(t *testing.T) {
+	// Create a temporary YAML configuration file
+	yamlContent := `
+app:
+  name: "TestApp"
+  version: "1.0.0"
+http:
+  port: "8080"
+logger:
+  log_level: "debug"
+cache:
+  size: 100
+repository:
+  type: "disk"
+rateLimiter:
+  type: "local"
+  algorithm: "leaky_bucket"
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(yamlContent)
+	assert.NoError(t, err)
+	err = tmpFile.Close()
+	assert.NoError(t, err)
+
+	// Load configuration
+	_, err = NewConfig(tmpFile.Name())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "validation error")
+}
+
+func TestRateLimiterSettingsMustBePositive(t *testing.T) {
+	// Create a temporary YAML configuration file
+	yamlContent := `
+app:
+  name: "TestApp"
+  version: "1.0.0"
+http:
+  port: "8080"
+logger:
+  log_level: "debug"
+cache:
+  size: 100
+repository:
+  type: "disk"
+rateLimiter:
+  type: "local"
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(yamlContent)
+	assert.NoError(t, err)
+	err = tmpFile.Close()
+	assert.NoError(t, err)
+
+	// Limits of no requests would divide by zero, leases would be empty or never sync, the breaker would
+	// open on any failure, and no request could wait
+	for _, env := range []string{
+		"RATE_LIMITER_MAX_REQUESTS", "RATE_LIMITER_USER_REQUESTS", "RATE_LIMITER_INTERVAL", "RATE_LIMITER_BREAKER_THRESHOLD",
+		"RATE_LIMITER_LEASE_SIZE", "RATE_LIMITER_SYNC_INTERVAL", "RATE_LIMITER_MAX_WAITERS",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, "0")
+			_, err := NewConfig(tmpFile.Name())
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "validation error")
+		})
+	}
+}
+
+func TestSentinelRequiresMasterName(t *testing.T) {
+	// Create a temporary YAML configuration file
+	yamlContent := `
+app:
+  name: "TestApp"
+  version: "1.0.0"
+http:
+  port: "8080"
+logger:
+  log_level: "debug"
+cache:
+  size: 100
+repository:
+  type: "disk"
+rateLimiter:
+  type: "distributed"
+  redisMode: "sentinel"
+  redisAddrs: ["sentinel-1:26379", "sentinel-2:26379"]
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(yamlContent)
+	assert.NoError(t, err)
+	err = tmpFile.Close()
+	assert.NoError(t, err)
+
+	// Load configuration
+	_, err = NewConfig(tmpFile.Name())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "RedisMasterName")
+}
+
+func TestJWTRequiresIssuerAndAudience(t *testing.T) {
+	// Create a temporary YAML configuration file
+	yamlContent := `
+app:
+  name: "TestApp"
+  version: "1.0.0"
+http:
+  port: "8080"
+logger:
+  log_level: "debug"
+cache:
+  size: 100
+repository:
+  type: "disk"
+rateLimiter:
+  type: "local"
+auth:
+  jwt:
+    jwksURL: "https://issuer.example.com/.well-known/jwks.json"
+    issuer: "https://issuer.example.com"
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(yamlContent)
+	assert.NoError(t, err)
+	err = tmpFile.Close()
+	assert.NoError(t, err)
+
+	// Load configuration
+	_, err = NewConfig(tmpFile.Name())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Audience")
+}
+
+func TestHTTPDefaults(t *testing.T) {
+	// Create a temporary YAML configuration file
+	yamlContent := `
+app:
+  name: "TestApp"
+  version: "1.0.0"
+http:
+  port: "8080"
+  maxInFlight: 500
+logger:
+  log_level: "debug"
+cache:
+  size: 100
+repository:
+  type: "disk"
+rateLimiter:
+  type: "local"
+`
+	tmpFile, err := os.CreateTemp("", "config-*.yml")
+	assert.NoError(t, err)
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(yamlContent)
+	assert.NoError(t, err)
+	err = tmpFile.Close()
+	assert.NoError(t, err)
+
+	// Load configuration
+	cfg, err := NewConfig(tmpFile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, cfg.HTTP.ReadTimeout)
+	assert.Equal(t, 2*time.Second, cfg.HTTP.ReadHeaderTimeout)
+	assert.Equal(t, 60*time.Second, cfg.HTTP.IdleTimeout)
+	assert.Equal(t, 1<<20, cfg.HTTP.MaxHeaderBytes)
+	assert.Equal(t, 3*time.Second, cfg.HTTP.ShutdownTimeout)
+	assert.False(t, cfg.HTTP.DisableKeepAlives)
+	assert.Equal(t, 500, cfg.HTTP.MaxInFlight)
+	assert.Zero(t, cfg.HTTP.MaxConns)
+}
@@ -23,7 +23,11 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "produces": [
-                    "application/json"
+                    "application/json",
+                    "application/xml",
+                    "text/csv",
+                    "application/msgpack",
+                    "text/plain"
                 ],
                 "summary": "Find Country",
                 "operationId": "find-country",
@@ -34,6 +38,31 @@ const docTemplate = `{
                         "name": "ip",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "enum": [
+                            "json",
+                            "xml",
+                            "csv",
+                            "msgpack",
+                            "text"
+                        ],
+                        "type": "string",
+                        "description": "Response format, overriding the Accept header",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "API key, also accepted in the X-API-Key header",
+                        "name": "api_key",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the cached response",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -41,24 +70,193 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/v1.findCountryResponse"
+                        },
+                        "headers": {
+                            "Cache-Control": {
+                                "type": "string",
+                                "description": "How long the response can be cached"
+                            },
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the response, changing with the dataset"
+                            },
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Maximum number of requests available to the client"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Number of requests still available to the client"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until all requests are available again"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified",
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Maximum number of requests available to the client"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Number of requests still available to the client"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until all requests are available again"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/v1.response"
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Maximum number of requests available to the client"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Number of requests still available to the client"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until all requests are available again"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/v1.response"
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Maximum number of requests available to the client"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Number of requests still available to the client"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until all requests are available again"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/v1.response"
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Maximum number of requests available to the client"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Number of requests still available to the client"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until all requests are available again"
+                            }
+                        }
+                    },
+                    "406": {
+                        "description": "Not Acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/v1.response"
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Maximum number of requests available to the client"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Number of requests still available to the client"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until all requests are available again"
+                            }
                         }
                     },
                     "429": {
                         "description": "Too Many Requests",
                         "schema": {
                             "$ref": "#/definitions/v1.response"
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Maximum number of requests available to the client"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Number of requests still available to the client"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until all requests are available again"
+                            },
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
                             "$ref": "#/definitions/v1.response"
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Maximum number of requests available to the client"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Number of requests still available to the client"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until all requests are available again"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/v1.response"
+                        },
+                        "headers": {
+                            "RateLimit-Limit": {
+                                "type": "integer",
+                                "description": "Maximum number of requests available to the client"
+                            },
+                            "RateLimit-Remaining": {
+                                "type": "integer",
+                                "description": "Number of requests still available to the client"
+                            },
+                            "RateLimit-Reset": {
+                                "type": "integer",
+                                "description": "Seconds until all requests are available again"
+                            },
+                            "Retry-After": {
+                                "type": "integer",
+                                "description": "Seconds to wait before retrying"
+                            }
                         }
                     }
                 }
@@ -0,0 +1,162 @@
+// Package apikey authenticates API keys and resolves their rate limiting tiers.
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+// ErrInvalidKey is returned for requests carrying an unknown API key.
+var ErrInvalidKey = errors.New("invalid API key")
+
+// Tier is a class of API keys sharing the same limits.
+type Tier struct {
+	Name   string
+	Limit  ratelimiter.Limit
+	Quotas []ratelimiter.Quota
+}
+
+// Key is an authenticated API key.
+type Key struct {
+	Name  string
+	Tier  Tier
+	Roles []string
+}
+
+// Store holds the API keys from the configuration and the optional key file,
+// by their SHA-256 digest so that keys configured as hashes work the same.
+type Store struct {
+	header     string
+	queryParam string
+	keys       map[[sha256.Size]byte]Key
+}
+
+func New(cfg config.APIKeys) (*Store, error) {
+	tiers := make(map[string]Tier, len(cfg.Tiers))
+	for _, t := range cfg.Tiers {
+		tiers[t.Name] = newTier(t)
+	}
+
+	keys := cfg.Keys
+	if cfg.File != "" {
+		fileKeys, err := readFile(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys[:len(keys):len(keys)], fileKeys...)
+	}
+
+	s := &Store{
+		header:     cfg.Header,
+		queryParam: cfg.QueryParam,
+		keys:       make(map[[sha256.Size]byte]Key, len(keys)),
+	}
+
+	for _, k := range keys {
+		tier, ok := tiers[k.Tier]
+		if !ok {
+			return nil, fmt.Errorf("apikey - New - key %q: unknown tier %q", k.Name, k.Tier)
+		}
+		digest, err := keyDigest(k)
+		if err != nil {
+			return nil, fmt.Errorf("apikey - New - key %q: %w", k.Name, err)
+		}
+		if _, exists := s.keys[digest]; exists {
+			return nil, fmt.Errorf("apikey - New - key %q: duplicate key", k.Name)
+		}
+		s.keys[digest] = Key{Name: k.Name, Tier: tier, Roles: k.Roles}
+	}
+
+	return s, nil
+}
+
+// Authenticate returns the API key carried by the request's header or query
+// parameter, nil if there is none, or ErrInvalidKey if it is unknown.
+func (s *Store) Authenticate(r *http.Request) (*Key, error) {
+	raw := r.Header.Get(s.header)
+	if raw == "" {
+		raw = r.URL.Query().Get(s.queryParam)
+	}
+
+	return s.lookup(raw)
+}
+
+// AuthenticateHeader returns the API key carried by header, for protocols
+// without query parameters, nil if there is none, or ErrInvalidKey if it is unknown.
+func (s *Store) AuthenticateHeader(header http.Header) (*Key, error) {
+	return s.lookup(header.Get(s.header))
+}
+
+func (s *Store) lookup(raw string) (*Key, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	key, ok := s.keys[sha256.Sum256([]byte(raw))]
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	return &key, nil
+}
+
+// keyDigest returns the SHA-256 digest of a configured key, or decodes its hash.
+func keyDigest(k config.APIKey) ([sha256.Size]byte, error) {
+	var digest [sha256.Size]byte
+	switch {
+	case k.Hash == "" && k.Key == "":
+		return digest, errors.New("key or hash is required")
+	case k.Hash == "":
+		return sha256.Sum256([]byte(k.Key)), nil
+	}
+
+	n, err := hex.Decode(digest[:], []byte(k.Hash))
+	if err != nil || n != sha256.Size {
+		return digest, errors.New("hash must be a hex encoded SHA-256 digest")
+	}
+
+	return digest, nil
+}
+
+func newTier(cfg config.APITier) Tier {
+	tier := Tier{
+		Name: cfg.Name,
+		Limit: ratelimiter.Limit{
+			Requests: cfg.Requests,
+			Burst:    cfg.Burst,
+			Interval: cfg.Interval,
+		},
+	}
+
+	if cfg.DailyQuota > 0 {
+		tier.Quotas = append(tier.Quotas, ratelimiter.Quota{Period: ratelimiter.Daily, Requests: cfg.DailyQuota})
+	}
+	if cfg.MonthlyQuota > 0 {
+		tier.Quotas = append(tier.Quotas, ratelimiter.Quota{Period: ratelimiter.Monthly, Requests: cfg.MonthlyQuota})
+	}
+
+	return tier
+}
+
+// readFile reads a JSON array of keys, in the same format as the configuration.
+func readFile(path string) ([]config.APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("apikey - readFile: %w", err)
+	}
+
+	var keys []config.APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("apikey - readFile: %w", err)
+	}
+
+	return keys, nil
+}
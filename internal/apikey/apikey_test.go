@@ -0,0 +1,112 @@
+package apikey
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+func testConfig() config.APIKeys {
+	return config.APIKeys{
+		Header:     "X-API-Key",
+		QueryParam: "api_key",
+		Tiers: []config.APITier{
+			{Name: "free", Requests: 10, Interval: time.Second, DailyQuota: 1000},
+			{Name: "partner", Requests: 100, Burst: 200, Interval: time.Second, MonthlyQuota: 50000},
+		},
+		Keys: []config.APIKey{
+			{Name: "acme", Key: "acme-key", Tier: "partner"},
+		},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	cfg := testConfig()
+	cfg.File = filepath.Join(t.TempDir(), "keys.json")
+	err := os.WriteFile(cfg.File, []byte(`[{"name": "hobby", "key": "hobby-key", "tier": "free"}]`), 0600)
+	assert.NoError(t, err)
+
+	store, err := New(cfg)
+	assert.NoError(t, err)
+
+	// Key from the header
+	req := httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set("X-API-Key", "acme-key")
+	key, err := store.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", key.Name)
+	assert.Equal(t, ratelimiter.Limit{Requests: 100, Burst: 200, Interval: time.Second}, key.Tier.Limit)
+	assert.Equal(t, []ratelimiter.Quota{{Period: ratelimiter.Monthly, Requests: 50000}}, key.Tier.Quotas)
+
+	// Key from the query, loaded from the key file
+	req = httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8&api_key=hobby-key", nil)
+	key, err = store.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "hobby", key.Name)
+	assert.Equal(t, "free", key.Tier.Name)
+
+	// No key
+	req = httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	key, err = store.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+
+	// Unknown key
+	req = httptest.NewRequest("GET", "/v1/find-country?ip=8.8.8.8", nil)
+	req.Header.Set("X-API-Key", "unknown")
+	_, err = store.Authenticate(req)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	// Header only, e.g. gRPC metadata
+	key, err = store.AuthenticateHeader(http.Header{"X-Api-Key": {"acme-key"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", key.Name)
+}
+
+func TestNewUnknownTier(t *testing.T) {
+	cfg := testConfig()
+	cfg.Keys = append(cfg.Keys, config.APIKey{Name: "lost", Key: "lost-key", Tier: "enterprise"})
+
+	_, err := New(cfg)
+	assert.Error(t, err)
+}
+
+func TestHashedKeys(t *testing.T) {
+	cfg := testConfig()
+	cfg.Keys = append(cfg.Keys, config.APIKey{
+		Name:  "ops",
+		Hash:  "ae58499cbf96dabd185f72ae281914ffe58af5328ae1902b63682f97bf3fb645", // sha256("hobby-key")
+		Tier:  "free",
+		Roles: []string{"metrics"},
+	})
+
+	store, err := New(cfg)
+	assert.NoError(t, err)
+
+	key, err := store.AuthenticateHeader(http.Header{"X-Api-Key": {"hobby-key"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "ops", key.Name)
+	assert.Equal(t, []string{"metrics"}, key.Roles)
+
+	// The same key, hashed or not, can't be configured twice
+	cfg.Keys = append(cfg.Keys, config.APIKey{Name: "dup", Key: "hobby-key", Tier: "free"})
+	_, err = New(cfg)
+	assert.Error(t, err)
+
+	cfg.Keys = []config.APIKey{{Name: "bad", Hash: "not-a-digest", Tier: "free"}}
+	_, err = New(cfg)
+	assert.Error(t, err)
+
+	// Keys from the key file aren't validated with the configuration
+	cfg.Keys = []config.APIKey{{Name: "empty", Tier: "free"}}
+	_, err = New(cfg)
+	assert.Error(t, err)
+}
@@ -2,20 +2,37 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
 
 	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/apikey"
+	"github.com/ransoor2/ip2country/internal/auth"
+	grpcv1 "github.com/ransoor2/ip2country/internal/controller/grpc/v1"
+	"github.com/ransoor2/ip2country/internal/controller/http/httpcache"
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
 	v1 "github.com/ransoor2/ip2country/internal/controller/http/v1"
+	v2 "github.com/ransoor2/ip2country/internal/controller/http/v2"
+	"github.com/ransoor2/ip2country/internal/geopolicy"
 	"github.com/ransoor2/ip2country/internal/ip2country"
 	"github.com/ransoor2/ip2country/internal/repositories/disk"
 	"github.com/ransoor2/ip2country/internal/repositories/mongo"
 	"github.com/ransoor2/ip2country/pkg/cache"
+	"github.com/ransoor2/ip2country/pkg/grpcserver"
+	"github.com/ransoor2/ip2country/pkg/health"
 	"github.com/ransoor2/ip2country/pkg/httpserver"
+	"github.com/ransoor2/ip2country/pkg/ipfilter"
 	"github.com/ransoor2/ip2country/pkg/logger"
 	"github.com/ransoor2/ip2country/pkg/ratelimiter"
 )
@@ -30,54 +47,414 @@ const (
 const (
 	RateLimiterTypeLocal       = "local"
 	RateLimiterTypeDistributed = "distributed"
+	RateLimiterTypeHybrid      = "hybrid"
 )
 
-// Run creates objects via constructors.
-func Run(cfg *config.Config) {
-	l := logger.New(cfg.Log.Level)
+// adminWriteTimeout lets the admin server write pprof profiles, which take 30s by default.
+const adminWriteTimeout = time.Minute
+
+// pinger is a dependency whose availability is checked for readiness.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// tunableRateLimiter is a rate limiter that can be inspected and tuned at runtime, and closed on shutdown.
+type tunableRateLimiter interface {
+	middleware.RateLimiter
+	v1.RateLimiterAdmin
+	Close()
+}
+
+// App owns the components of the service and their lifecycle: New builds
+// them, Start serves them, and Stop shuts them down in order. It can be
+// embedded in other binaries and in-process tests.
+type App struct {
+	cfg *config.Config
+	log logger.Interface
+
+	repo          ip2country.Repository
+	rateLimiter   tunableRateLimiter
+	authenticator *auth.Chain
+	ipFilter      *ipfilter.Filter
+	service       *ip2country.IP2Country
+	checker       *health.Checker
+
+	handler         *gin.Engine
+	internalHandler *gin.Engine
+	grpcRouter      *grpc.Server
+	grpcHealth      *grpchealth.Server
+
+	httpServer   *httpserver.Server
+	adminServer  *httpserver.Server
+	grpcServer   *grpcserver.Server
+	cancelWarmUp context.CancelFunc
+	errs         chan error
+	stopOnce     sync.Once
+	stopErr      error
+}
+
+// closer is a component holding connections, e.g. the MongoDB repository.
+type closer interface {
+	Close(ctx context.Context) error
+}
+
+// New builds the components of the service. Those already built are closed
+// if one fails.
+func New(cfg *config.Config) (*App, error) {
+	a := &App{
+		cfg:  cfg,
+		log:  logger.New(cfg.Log.Level),
+		errs: make(chan error, 1),
+	}
+
+	if err := a.build(); err != nil {
+		closeErr := a.closeComponents(context.Background())
+		return nil, errors.Join(err, closeErr)
+	}
+
+	return a, nil
+}
+
+func (a *App) build() error {
+	cfg, l := a.cfg, a.log
 
 	// Cache
 	cacheInst, err := cache.New(cfg.Cache.Size)
 	if err != nil {
-		l.Fatal(fmt.Errorf("app - Run - cacheInst.New: %w", err))
+		return fmt.Errorf("app - New - cache.New: %w", err)
 	}
 
 	// Repository
+	// Failed constructors return typed values, only those built are closed
 	repo, err := initializeRepository(cfg)
 	if err != nil {
-		l.Fatal(fmt.Errorf("app - Run - initializeRepository: %w", err))
+		return fmt.Errorf("app - New - initializeRepository: %w", err)
 	}
+	a.repo = repo
 
 	// RateLimiter
 	rateLimiter, err := getRateLimiter(cfg, l)
 	if err != nil {
-		l.Fatal(fmt.Errorf("app - Run - getRateLimiter: %w", err))
+		return fmt.Errorf("app - New - getRateLimiter: %w", err)
+	}
+	a.rateLimiter = rateLimiter
+
+	// Requests wait for their turn rather than being rejected, if they can be admitted soon enough
+	limiter := middleware.RateLimiter(a.rateLimiter)
+	if cfg.RateLimiter.MaxWait > 0 {
+		limiter = ratelimiter.NewWaitingRateLimiter(a.rateLimiter, cfg.RateLimiter)
+	}
+
+	keyer := ratelimiter.NewKeyer(cfg.RateLimiter)
+
+	// API keys
+	apiKeys, err := apikey.New(cfg.APIKeys)
+	if err != nil {
+		return fmt.Errorf("app - New - apikey.New: %w", err)
+	}
+
+	// Authentication
+	a.authenticator, err = auth.New(cfg.Auth, apiKeys, cfg.Admin.Token, l)
+	if err != nil {
+		return fmt.Errorf("app - New - auth.New: %w", err)
+	}
+
+	// IP filter
+	a.ipFilter, err = ipfilter.New(cfg.IPFilter, l)
+	if err != nil {
+		return fmt.Errorf("app - New - ipfilter.New: %w", err)
+	}
+
+	// Geo policies
+	geoPolicies, err := geopolicy.New(cfg.GeoPolicies)
+	if err != nil {
+		return fmt.Errorf("app - New - geopolicy.New: %w", err)
 	}
 
 	// Use case
-	ip2CountryService := ip2country.New(repo, l, cacheInst)
+	a.service = ip2country.New(a.repo, l, cacheInst)
+
+	// Readiness
+	a.checker = health.New(cfg.Health.CheckTimeout)
+	a.checker.Register("repository", a.service.Ping)
+	a.checker.Register("cache", a.service.WarmedUp)
+	if redis, ok := a.rateLimiter.(pinger); ok {
+		// The limiter falls back without Redis, unless it fails closed
+		if cfg.RateLimiter.OnFailure == ratelimiter.FailClosed {
+			a.checker.Register("redis", redis.Ping)
+		} else {
+			a.checker.RegisterOptional("redis", redis.Ping)
+		}
+	}
+
+	// HTTP routes
+	a.handler = gin.New()
+	if err = a.handler.SetTrustedProxies(cfg.HTTP.TrustedProxies); err != nil {
+		return fmt.Errorf("app - New - SetTrustedProxies: %w", err)
+	}
+	a.handler.Use(middleware.AccessLog(cfg.APIKeys.QueryParam))
+	cachePolicy := httpcache.New(cfg.HTTPCache, a.service, cfg.Auth.Routes.Lookup)
+	inFlight := middleware.NewInFlight(cfg.HTTP.MaxInFlight)
+	v1.NewRouter(a.handler, l, a.service, inFlight, limiter, keyer, a.authenticator, a.ipFilter, geoPolicies, cachePolicy, cfg.Auth.Routes)
+	v2.NewRouter(a.handler, l, a.service, inFlight, limiter, keyer, a.authenticator, a.ipFilter, geoPolicies, cachePolicy, cfg.Auth.Routes)
+
+	// The routes of operators move to the admin listener if there is one
+	a.internalHandler = a.handler
+	if cfg.Admin.Port != "" {
+		a.internalHandler = gin.New()
+		if err = a.internalHandler.SetTrustedProxies(cfg.HTTP.TrustedProxies); err != nil {
+			return fmt.Errorf("app - New - SetTrustedProxies: %w", err)
+		}
+		a.internalHandler.Use(middleware.AccessLog(cfg.APIKeys.QueryParam))
+		a.internalHandler.Use(gin.Recovery())
+	}
+	v1.NewInternalRouter(a.internalHandler, a.authenticator, a.checker, cfg.Auth.Routes, cfg.Admin.Pprof)
+	v1.NewAdminRouter(a.internalHandler, l, a.rateLimiter, a.authenticator, cfg.Auth.Routes.Admin)
+
+	// gRPC routes
+	a.grpcHealth = grpchealth.NewServer()
+	a.grpcRouter = grpcv1.NewRouter(l, a.grpcHealth, a.service, limiter, keyer,
+		a.authenticator, cfg.Auth.Routes.Lookup, a.ipFilter, geoPolicies)
+
+	return nil
+}
+
+// Handler returns the handler of the HTTP API, e.g. for in-process tests.
+func (a *App) Handler() http.Handler {
+	return a.handler
+}
+
+// InternalHandler returns the handler of the probes, metrics and admin
+// routes, which is Handler unless there is an admin listener.
+func (a *App) InternalHandler() http.Handler {
+	return a.internalHandler
+}
+
+// Start warms the cache up in the background and starts the servers. It
+// fails if a server can't listen, and the servers that started are stopped
+// by Stop. The warm-up lasts until done or Stop, whatever happens to ctx.
+func (a *App) Start(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("app - Start: %w", err)
+	}
+
+	warmUpCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	a.cancelWarmUp = cancel
+	go a.service.WarmUp(warmUpCtx, a.cfg.Cache.WarmUpIPs)
 
 	// HTTP Server
-	handler := gin.New()
-	v1.NewRouter(handler, l, ip2CountryService, rateLimiter)
-	httpServer := httpserver.New(handler, httpserver.Port(cfg.HTTP.Port))
+	httpOpts, err := httpServerOptions(a.cfg.HTTP, a.log)
+	if err != nil {
+		return fmt.Errorf("app - Start - httpServerOptions: %w", err)
+	}
+	a.httpServer = httpserver.New(a.handler, httpOpts...)
+	if err := a.watch("httpServer", a.httpServer.Notify()); err != nil {
+		return err
+	}
 
-	// Waiting signal
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	// Admin Server
+	if a.cfg.Admin.Port != "" {
+		a.adminServer = httpserver.New(a.internalHandler,
+			httpserver.Port(a.cfg.Admin.Port),
+			httpserver.WriteTimeout(adminWriteTimeout),
+			httpserver.ShutdownTimeout(a.cfg.HTTP.ShutdownTimeout),
+			httpserver.Logger(a.log),
+		)
+		if err := a.watch("adminServer", a.adminServer.Notify()); err != nil {
+			return err
+		}
+	}
+
+	// gRPC Server
+	a.grpcServer = grpcserver.New(a.grpcRouter,
+		grpcserver.Port(a.cfg.GRPC.Port),
+		grpcserver.ShutdownTimeout(a.cfg.GRPC.ShutdownTimeout),
+	)
+	return a.watch("grpcServer", a.grpcServer.Notify())
+}
 
+// watch returns the error of a server that failed to start, and reports the
+// errors of the server afterwards on Err.
+func (a *App) watch(name string, notify <-chan error) error {
 	select {
-	case s := <-interrupt:
-		l.Info("app - Run - signal: " + s.String())
-	case err = <-httpServer.Notify():
-		l.Error(fmt.Errorf("app - Run - httpServer.Notify: %w", err))
+	case err := <-notify:
+		return fmt.Errorf("app - Start - %s: %w", name, err)
+	default:
+	}
+
+	go func() {
+		for err := range notify {
+			if err == nil || errors.Is(err, http.ErrServerClosed) {
+				continue
+			}
+			select {
+			case a.errs <- fmt.Errorf("app - %s: %w", name, err):
+			default:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Err reports the first server failing after Start.
+func (a *App) Err() <-chan error {
+	return a.errs
+}
+
+// Stop fails readiness and keeps serving for Health.ShutdownDelay, so that
+// load balancers stop sending requests, or until ctx is done. It then stops
+// the public servers, the admin server, which serves the probes until then,
+// and the components, in the reverse order of their dependencies. Each server
+// has its own shutdown timeout, and connections are closed within ctx. Stop
+// returns the errors met along the way, and only runs once.
+func (a *App) Stop(ctx context.Context) error {
+	a.stopOnce.Do(func() {
+		a.stopErr = a.stop(ctx)
+	})
+
+	return a.stopErr
+}
+
+func (a *App) stop(ctx context.Context) error {
+	var errs []error
+
+	// Fail readiness, and keep serving until load balancers stop sending requests
+	a.checker.Drain()
+	a.grpcHealth.Shutdown()
+	if a.httpServer != nil && a.cfg.Health.ShutdownDelay > 0 {
+		timer := time.NewTimer(a.cfg.Health.ShutdownDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	if a.httpServer != nil {
+		if err := a.httpServer.Shutdown(); err != nil {
+			errs = append(errs, fmt.Errorf("app - Stop - httpServer.Shutdown: %w", err))
+		}
+	}
+	if a.grpcServer != nil {
+		a.grpcServer.Shutdown()
+	}
+	if a.adminServer != nil {
+		if err := a.adminServer.Shutdown(); err != nil {
+			errs = append(errs, fmt.Errorf("app - Stop - adminServer.Shutdown: %w", err))
+		}
+	}
+	if a.cancelWarmUp != nil {
+		a.cancelWarmUp()
+	}
+
+	errs = append(errs, a.closeComponents(ctx))
+
+	return errors.Join(errs...)
+}
+
+// closeComponents closes the components built so far.
+func (a *App) closeComponents(ctx context.Context) error {
+	if a.ipFilter != nil {
+		a.ipFilter.Close()
+	}
+	if a.authenticator != nil {
+		a.authenticator.Close()
+	}
+	// Save the local buckets, or charge the requests admitted under hybrid leases, and close Redis
+	if a.rateLimiter != nil {
+		a.rateLimiter.Close()
+	}
+	if c, ok := a.repo.(closer); ok {
+		if err := c.Close(ctx); err != nil {
+			return fmt.Errorf("app - Stop - repository.Close: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Run starts the service, and stops it within App.StopTimeout on SIGINT or
+// SIGTERM, or when a server fails.
+func Run(cfg *config.Config) error {
+	a, err := New(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = a.Start(context.Background())
+	if err == nil {
+		// Waiting signal
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+		select {
+		case s := <-interrupt:
+			a.log.Info("app - Run - signal: " + s.String())
+		case err = <-a.Err():
+			a.log.Error(fmt.Errorf("app - Run - %w", err))
+		}
 	}
 
 	// Shutdown
-	err = httpServer.Shutdown()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.App.StopTimeout)
+	defer cancel()
+
+	return errors.Join(err, a.Stop(ctx))
+}
+
+// httpServerOptions serves plaintext HTTP, or HTTPS when a certificate is
+// configured, on the HTTP port, and HTTPS next to it on the TLS port if set.
+// The Unix socket serves plaintext HTTP, and so does h2c when enabled.
+func httpServerOptions(cfg config.HTTP, l logger.Interface) ([]httpserver.Option, error) {
+	opts := []httpserver.Option{
+		httpserver.Host(cfg.Host),
+		httpserver.Port(cfg.Port),
+		httpserver.ReadTimeout(cfg.ReadTimeout),
+		httpserver.ReadHeaderTimeout(cfg.ReadHeaderTimeout),
+		httpserver.WriteTimeout(cfg.WriteTimeout),
+		httpserver.IdleTimeout(cfg.IdleTimeout),
+		httpserver.MaxHeaderBytes(cfg.MaxHeaderBytes),
+		httpserver.KeepAlives(!cfg.DisableKeepAlives),
+		httpserver.MaxConns(cfg.MaxConns),
+		httpserver.ShutdownTimeout(cfg.ShutdownTimeout),
+		httpserver.Logger(l),
+	}
+	if cfg.H2C {
+		opts = append(opts, httpserver.H2C())
+	}
+	if cfg.UnixSocket != "" {
+		opts = append(opts, httpserver.UnixSocket(cfg.UnixSocket))
+	}
+	if cfg.TLS.CertFile == "" {
+		return opts, nil
+	}
+
+	minVersion, err := httpserver.ParseTLSVersion(cfg.TLS.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := httpserver.ParseCipherSuites(cfg.TLS.CipherSuites)
 	if err != nil {
-		l.Error(fmt.Errorf("app - Run - httpServer.Shutdown: %w", err))
+		return nil, err
+	}
+
+	opts = append(opts,
+		httpserver.TLS(cfg.TLS.CertFile, cfg.TLS.KeyFile),
+		httpserver.TLSMinVersion(minVersion),
+		httpserver.CertReloadInterval(cfg.TLS.ReloadInterval),
+	)
+	if len(cipherSuites) > 0 {
+		opts = append(opts, httpserver.TLSCipherSuites(cipherSuites))
 	}
+	if cfg.TLS.Port != "" {
+		opts = append(opts, httpserver.TLSPort(cfg.TLS.Port))
+	}
+	if cfg.TLS.ClientCAFile != "" {
+		opts = append(opts, httpserver.ClientCAs(cfg.TLS.ClientCAFile, cfg.TLS.ClientAuth == "required"))
+	}
+
+	return opts, nil
 }
 
 func initializeRepository(cfg *config.Config) (ip2country.Repository, error) {
@@ -91,12 +468,14 @@ func initializeRepository(cfg *config.Config) (ip2country.Repository, error) {
 	}
 }
 
-func getRateLimiter(cfg *config.Config, l logger.Interface) (v1.RateLimiter, error) {
+func getRateLimiter(cfg *config.Config, l logger.Interface) (tunableRateLimiter, error) {
 	switch cfg.RateLimiter.Type {
 	case RateLimiterTypeLocal:
 		return ratelimiter.NewLocalRateLimiter(cfg.RateLimiter, l), nil
 	case RateLimiterTypeDistributed:
-		return ratelimiter.NewDistributedRateLimiter(cfg.RateLimiter, l), nil
+		return ratelimiter.NewDistributedRateLimiter(cfg.RateLimiter, l)
+	case RateLimiterTypeHybrid:
+		return ratelimiter.NewHybridRateLimiter(cfg.RateLimiter, l)
 	default:
 		return nil, fmt.Errorf("unknown rate limiter type: %s", cfg.RateLimiter.Type)
 	}
@@ -0,0 +1,192 @@
+// Package auth identifies the principals behind requests, by API key, admin
+// token, JWT bearer token or client certificate, and authorizes them by role.
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/apikey"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+// Authentication methods, the Method of principals.
+const (
+	MethodAPIKey = "apikey"
+	MethodToken  = "token"
+	MethodJWT    = "jwt"
+	MethodMTLS   = "mtls"
+)
+
+// Policies of routes besides the roles they require, see config.AuthRoutes.
+const (
+	// Public routes are open to anonymous clients.
+	Public = "public"
+	// Authenticated routes are open to any principal, whatever its roles.
+	Authenticated = "authenticated"
+)
+
+var (
+	// ErrInvalidCredentials is returned for requests carrying credentials no authenticator recognizes.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUnauthenticated is returned by Authorize for anonymous requests to routes requiring a principal.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden is returned by Authorize for principals lacking the role of a route.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Principal is the authenticated identity behind a request.
+type Principal struct {
+	// Name identifies the principal among those of its Method.
+	Name   string
+	Method string
+	Roles  []string
+	// Key is the API key of principals authenticated by one, from which they get their tier.
+	Key *apikey.Key
+}
+
+// ID identifies the principal among all methods, e.g. "jwt:alice".
+func (p *Principal) ID() string {
+	return p.Method + ":" + p.Name
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// Authorize checks that p, nil for anonymous requests, satisfies policy: public,
+// authenticated, or the name of the role required.
+func Authorize(p *Principal, policy string) error {
+	switch {
+	case policy == "" || policy == Public:
+		return nil
+	case p == nil:
+		return ErrUnauthenticated
+	case policy == Authenticated || p.HasRole(policy):
+		return nil
+	default:
+		return ErrForbidden
+	}
+}
+
+// Authenticator identifies the principal of a request. It returns nil if the
+// request carries none of its credentials, and an error if they are invalid.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries its authenticators in order, the first to identify a principal wins.
+type Chain struct {
+	authenticators []Authenticator
+}
+
+func NewChain(authenticators ...Authenticator) *Chain {
+	return &Chain{authenticators: authenticators}
+}
+
+// New returns the chain of the configured authenticators: API keys, the admin
+// token, which grants the role of the admin routes, JWTs if a JWKS is
+// configured, and client certificates verified by the TLS server.
+func New(cfg config.Auth, apiKeys APIKeyStore, adminToken string, l logger.Interface) (*Chain, error) {
+	authenticators := []Authenticator{NewAPIKeys(apiKeys)}
+
+	if adminToken != "" {
+		authenticators = append(authenticators, NewToken("admin", adminToken, cfg.Routes.Admin))
+	}
+
+	if cfg.JWT.JWKSFile != "" || cfg.JWT.JWKSURL != "" {
+		jwtAuth, err := NewJWT(cfg.JWT, l)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, jwtAuth)
+	}
+
+	authenticators = append(authenticators, NewMTLS(cfg.MTLS))
+
+	return NewChain(authenticators...), nil
+}
+
+// Authenticate returns the principal of the first authenticator recognizing
+// the request's credentials, nil if there are none, or ErrInvalidCredentials
+// if it carries an Authorization header nobody recognizes.
+func (c *Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c.authenticators {
+		p, err := a.Authenticate(r)
+		if err != nil || p != nil {
+			return p, err
+		}
+	}
+
+	if r.Header.Get("Authorization") != "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	return nil, nil
+}
+
+// Close stops the background work of the authenticators, e.g. JWKS refreshes.
+func (c *Chain) Close() {
+	for _, a := range c.authenticators {
+		if closer, ok := a.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+}
+
+type APIKeyStore interface {
+	Authenticate(r *http.Request) (*apikey.Key, error)
+}
+
+type apiKeys struct {
+	store APIKeyStore
+}
+
+// NewAPIKeys authenticates API keys, whose principals have the roles of their key.
+func NewAPIKeys(store APIKeyStore) Authenticator {
+	return apiKeys{store: store}
+}
+
+func (a apiKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key, err := a.store.Authenticate(r)
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	return &Principal{Name: key.Name, Method: MethodAPIKey, Roles: key.Roles, Key: key}, nil
+}
+
+type token struct {
+	name  string
+	token []byte
+	roles []string
+}
+
+// NewToken authenticates a static bearer token as the principal name with roles.
+// Other bearer tokens are left to the next authenticators.
+func NewToken(name, value string, roles ...string) Authenticator {
+	return token{name: name, token: []byte(value), roles: roles}
+}
+
+func (a token) Authenticate(r *http.Request) (*Principal, error) {
+	bearer, ok := bearerToken(r)
+	if !ok || subtle.ConstantTimeCompare([]byte(bearer), a.token) != 1 {
+		return nil, nil
+	}
+
+	return &Principal{Name: a.name, Method: MethodToken, Roles: a.roles}, nil
+}
+
+// bearerToken returns the bearer token of the request's Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || value == "" {
+		return "", false
+	}
+
+	return value, true
+}
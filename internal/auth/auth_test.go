@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/apikey"
+)
+
+func TestAuthorize(t *testing.T) {
+	alice := &Principal{Name: "alice", Method: MethodJWT, Roles: []string{"metrics"}}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		policy    string
+		err       error
+	}{
+		{name: "public", policy: Public},
+		{name: "no policy", policy: ""},
+		{name: "anonymous", policy: Authenticated, err: ErrUnauthenticated},
+		{name: "authenticated", principal: alice, policy: Authenticated},
+		{name: "role", principal: alice, policy: "metrics"},
+		{name: "anonymous role", policy: "metrics", err: ErrUnauthenticated},
+		{name: "missing role", principal: alice, policy: "admin", err: ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, Authorize(tt.principal, tt.policy), tt.err)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	store, err := apikey.New(config.APIKeys{
+		Header: "X-API-Key",
+		Tiers:  []config.APITier{{Name: "free", Requests: 10, Interval: time.Second}},
+		Keys:   []config.APIKey{{Name: "acme", Key: "acme-key", Tier: "free", Roles: []string{"metrics"}}},
+	})
+	assert.NoError(t, err)
+
+	chain, err := New(config.Auth{
+		Routes: config.AuthRoutes{Admin: "admin"},
+		MTLS:   config.MTLS{Identities: []config.MTLSIdentity{{Name: "scraper", Roles: []string{"metrics"}}}},
+	}, store, "admin-token", nil)
+	assert.NoError(t, err)
+	defer chain.Close()
+
+	// API key
+	req := httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+	req.Header.Set("X-API-Key", "acme-key")
+	p, err := chain.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "apikey:acme", p.ID())
+	assert.Equal(t, []string{"metrics"}, p.Roles)
+	assert.Equal(t, "free", p.Key.Tier.Name)
+
+	req.Header.Set("X-API-Key", "unknown")
+	_, err = chain.Authenticate(req)
+	assert.ErrorIs(t, err, apikey.ErrInvalidKey)
+
+	// Admin token
+	p, err = chain.Authenticate(bearerRequest("admin-token"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "admin", Method: MethodToken, Roles: []string{"admin"}}, p)
+
+	// Unrecognized bearer tokens are rejected rather than treated as anonymous
+	_, err = chain.Authenticate(bearerRequest("wrong-token"))
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Client certificate verified by the TLS server
+	req = httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "scraper"}}}}}
+	p, err = chain.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, &Principal{Name: "scraper", Method: MethodMTLS, Roles: []string{"metrics"}}, p)
+
+	// Unverified peer certificates don't authenticate
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "scraper"}}}}
+	p, err = chain.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+}
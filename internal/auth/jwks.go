@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+const (
+	// jwksFetchTimeout bounds the fetching of JWKS URLs.
+	jwksFetchTimeout = 10 * time.Second
+	// jwksMissCooldown is the minimum time between refreshes triggered by unknown key IDs.
+	jwksMissCooldown = 30 * time.Second
+	// maxJWKSSize bounds the size of JWKS documents.
+	maxJWKSSize = 1 << 20
+)
+
+// ErrUnknownKey is returned for tokens signed by a key missing from the JWKS.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// JWKS holds the public keys of a JSON Web Key Set (RFC 7517), read from a
+// file or fetched from a URL, and refreshed periodically and on unknown key IDs.
+type JWKS struct {
+	log       logger.Interface
+	file      string
+	url       string
+	client    *http.Client
+	refreshMu sync.Mutex // serializes refreshes
+	refreshed time.Time
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// jwk is a JSON Web Key, of which the RSA, EC and OKP (Ed25519) public keys are supported.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func NewJWKS(cfg config.JWT, l logger.Interface) (*JWKS, error) {
+	s := &JWKS{
+		log:    l,
+		file:   cfg.JWKSFile,
+		url:    cfg.JWKSURL,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		done:   make(chan struct{}),
+	}
+
+	if err := s.Refresh(); err != nil {
+		return nil, err
+	}
+
+	if cfg.RefreshInterval > 0 {
+		go s.watch(cfg.RefreshInterval)
+	}
+
+	return s, nil
+}
+
+// Key returns the key of kid, or the only key of the set for tokens without a
+// key ID. Unknown key IDs refresh the set, at most once per jwksMissCooldown,
+// in case the keys were rotated.
+func (s *JWKS) Key(kid string) (crypto.PublicKey, error) {
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	if s.refreshIfStale() {
+		if key, ok := s.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (s *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+
+	return key, ok
+}
+
+// refreshIfStale refreshes the set unless it was refreshed within
+// jwksMissCooldown, and reports whether it did.
+func (s *JWKS) refreshIfStale() bool {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	if time.Since(s.refreshed) < jwksMissCooldown {
+		return false
+	}
+	if err := s.refresh(); err != nil {
+		s.log.Error(fmt.Errorf("auth - JWKS - refreshIfStale: %w", err))
+		return false
+	}
+
+	return true
+}
+
+// Refresh rereads the set. The current keys are kept on error.
+func (s *JWKS) Refresh() error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	return s.refresh()
+}
+
+func (s *JWKS) refresh() error {
+	s.refreshed = time.Now()
+
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Close stops refreshing the set.
+func (s *JWKS) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+func (s *JWKS) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.Refresh(); err != nil {
+				s.log.Error(fmt.Errorf("auth - JWKS - watch: %w", err))
+			}
+		}
+	}
+}
+
+func (s *JWKS) read() ([]byte, error) {
+	if s.file != "" {
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return nil, fmt.Errorf("auth - JWKS - read: %w", err)
+		}
+		return data, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("auth - JWKS - read: %w", err)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("auth - JWKS - read: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth - JWKS - read: unexpected status %s", res.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("auth - JWKS - read: %w", err)
+	}
+
+	return data, nil
+}
+
+// parseJWKS returns the signature keys of a set by key ID. Keys of other uses
+// or unsupported types are skipped, so that new key types don't break the set.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("auth - parseJWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("auth - parseJWKS - key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("auth - parseJWKS: no signature keys")
+	}
+
+	return keys, nil
+}
+
+var errUnsupportedKey = errors.New("unsupported key type")
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		return k.ecdsaKey()
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errUnsupportedKey
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errUnsupportedKey
+	}
+}
+
+func (k jwk) ecdsaKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	var ecdhCurve ecdh.Curve
+	switch k.Crv {
+	case "P-256":
+		curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, errUnsupportedKey
+	}
+
+	x, errX := base64.RawURLEncoding.DecodeString(k.X)
+	y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+	size := (curve.Params().BitSize + 7) / 8
+	if errX != nil || errY != nil || len(x) != size || len(y) != size {
+		return nil, errors.New("invalid EC coordinates")
+	}
+
+	// Rejects points off the curve, from the uncompressed encoding of the point
+	point := append(append([]byte{4}, x...), y...)
+	if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("invalid EC key: %w", err)
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid integer")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+// ErrInvalidToken is returned for bearer tokens that aren't valid JWTs of the configured issuer and audience.
+var ErrInvalidToken = errors.New("invalid token")
+
+// signingMethods are the asymmetric algorithms accepted, as the keys come from a JWKS.
+var signingMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// JWT authenticates JWT bearer tokens signed by a key of the JWKS, as the
+// principal of their subject with the roles of the roles claim.
+type JWT struct {
+	parser     *jwt.Parser
+	rolesClaim string
+	keys       *JWKS
+}
+
+func NewJWT(cfg config.JWT, l logger.Interface) (*JWT, error) {
+	keys, err := NewJWKS(cfg, l)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWT{
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(signingMethods),
+			jwt.WithIssuer(cfg.Issuer),
+			jwt.WithAudience(cfg.Audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(cfg.Leeway),
+		),
+		rolesClaim: cfg.RolesClaim,
+		keys:       keys,
+	}, nil
+}
+
+// Authenticate returns the principal of the request's bearer token, nil if it
+// has none, or ErrInvalidToken if the token is invalid.
+func (a *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	bearer, ok := bearerToken(r)
+	if !ok {
+		return nil, nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(bearer, claims, a.key); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	return &Principal{Name: subject, Method: MethodJWT, Roles: roles(claims[a.rolesClaim])}, nil
+}
+
+// Close stops refreshing the JWKS.
+func (a *JWT) Close() {
+	a.keys.Close()
+}
+
+// key returns the JWKS key of the token's key ID.
+func (a *JWT) key(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	return a.keys.Key(kid)
+}
+
+// roles reads a roles claim, either an array of strings or a space separated
+// string like the OAuth scope claim.
+func roles(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		roles := make([]string, 0, len(v))
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles
+	default:
+		return nil
+	}
+}
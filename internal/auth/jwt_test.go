@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testAudience = "ip2country"
+)
+
+// signer signs test tokens with its key, published under kid.
+type signer struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+func newSigners(t *testing.T) []signer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	return []signer{
+		{kid: "rsa", method: jwt.SigningMethodRS256, key: rsaKey},
+		{kid: "ec", method: jwt.SigningMethodES256, key: ecKey},
+		{kid: "ed", method: jwt.SigningMethodEdDSA, key: edKey},
+	}
+}
+
+func (s signer) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(s.method, claims)
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	assert.NoError(t, err)
+
+	return signed
+}
+
+func (s signer) jwk() map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := s.key.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": s.kid, "use": "sig", "n": b64(pub.N.Bytes()),
+			"e": b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": s.kid, "crv": "P-256", "x": b64(pub.X.FillBytes(make([]byte, 32))),
+			"y": b64(pub.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": s.kid, "crv": "Ed25519", "x": b64(pub)}
+	default:
+		return nil
+	}
+}
+
+func writeJWKS(t *testing.T, path string, signers ...signer) {
+	t.Helper()
+
+	keys := make([]map[string]string, 0, len(signers)+1)
+	for _, s := range signers {
+		keys = append(keys, s.jwk())
+	}
+	// Encryption keys are skipped
+	keys = append(keys, map[string]string{"kty": "RSA", "kid": "enc", "use": "enc"})
+
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+}
+
+func claims(sub string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   sub,
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"metrics"},
+	}
+}
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/v1/find-country?ip=8.8.8.8", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+func testJWTConfig(jwksFile string) config.JWT {
+	return config.JWT{JWKSFile: jwksFile, Issuer: testIssuer, Audience: testAudience, RolesClaim: "roles"}
+}
+
+func TestJWT(t *testing.T) {
+	signers := newSigners(t)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, signers...)
+
+	a, err := NewJWT(testJWTConfig(jwksFile), logger.New("error"))
+	assert.NoError(t, err)
+	defer a.Close()
+
+	for _, s := range signers {
+		t.Run(s.kid, func(t *testing.T) {
+			p, err := a.Authenticate(bearerRequest(s.sign(t, claims("alice"))))
+			assert.NoError(t, err)
+			assert.Equal(t, &Principal{Name: "alice", Method: MethodJWT, Roles: []string{"metrics"}}, p)
+		})
+	}
+
+	// Space separated roles, like the OAuth scope claim
+	scoped := claims("bob")
+	scoped["roles"] = "metrics admin"
+	p, err := a.Authenticate(bearerRequest(signers[0].sign(t, scoped)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"metrics", "admin"}, p.Roles)
+
+	// Requests without a bearer token are left to other authenticators
+	p, err = a.Authenticate(httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+}
+
+func TestJWTInvalid(t *testing.T) {
+	signers := newSigners(t)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, signers[0])
+
+	a, err := NewJWT(testJWTConfig(jwksFile), logger.New("error"))
+	assert.NoError(t, err)
+	defer a.Close()
+
+	tests := []struct {
+		name   string
+		signer signer
+		claims func(jwt.MapClaims)
+	}{
+		{name: "wrong issuer", signer: signers[0], claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "wrong audience", signer: signers[0], claims: func(c jwt.MapClaims) { c["aud"] = "other" }},
+		{name: "expired", signer: signers[0], claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no expiry", signer: signers[0], claims: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "no subject", signer: signers[0], claims: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "unknown key", signer: signers[1], claims: func(jwt.MapClaims) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := claims("alice")
+			tt.claims(c)
+			_, err := a.Authenticate(bearerRequest(tt.signer.sign(t, c)))
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+
+	// Symmetric tokens can't be forged with the public key
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims("alice"))
+	signed, err := hmac.SignedString([]byte("secret"))
+	assert.NoError(t, err)
+	_, err = a.Authenticate(bearerRequest(signed))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJWKSRefresh(t *testing.T) {
+	signers := newSigners(t)
+	var jwks atomic.Value
+	publish := func(s signer) {
+		data, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{s.jwk()}})
+		assert.NoError(t, err)
+		jwks.Store(data)
+	}
+	publish(signers[0])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(jwks.Load().([]byte))
+	}))
+	defer server.Close()
+
+	cfg := testJWTConfig("")
+	cfg.JWKSURL = server.URL
+	cfg.RefreshInterval = 10 * time.Millisecond
+	a, err := NewJWT(cfg, logger.New("error"))
+	assert.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Authenticate(bearerRequest(signers[2].sign(t, claims("alice"))))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Rotated keys are picked up by the next refresh
+	publish(signers[2])
+	assert.Eventually(t, func() bool {
+		_, err := a.Authenticate(bearerRequest(signers[2].sign(t, claims("alice"))))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
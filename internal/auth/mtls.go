@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/ransoor2/ip2country/config"
+)
+
+type mtls struct {
+	roles map[string][]string
+}
+
+// NewMTLS authenticates client certificates verified by the TLS server as the
+// principal of their subject common name, with the roles of its identity.
+// Certificates of other names authenticate principals without roles.
+func NewMTLS(cfg config.MTLS) Authenticator {
+	a := mtls{roles: make(map[string][]string, len(cfg.Identities))}
+	for _, identity := range cfg.Identities {
+		a.roles[identity.Name] = append(a.roles[identity.Name], identity.Roles...)
+	}
+
+	return a
+}
+
+func (a mtls) Authenticate(r *http.Request) (*Principal, error) {
+	// Only the chains verified against the client CAs are trusted, not the peer certificates
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+
+	name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if name == "" {
+		return nil, nil
+	}
+
+	return &Principal{Name: name, Method: MethodMTLS, Roles: a.roles[name]}, nil
+}
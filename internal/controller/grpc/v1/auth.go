@@ -0,0 +1,51 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/ransoor2/ip2country/internal/auth"
+)
+
+// Authenticator identifies the principal of requests, nil if they carry no credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*auth.Principal, error)
+}
+
+// authenticate returns the principal of the call, from the same credentials
+// as the HTTP API, or the status error rejecting it if the principal doesn't
+// satisfy the lookup policy.
+func (g *guard) authenticate(ctx context.Context, header http.Header) (*auth.Principal, error) {
+	p, err := g.authenticator.Authenticate(httpRequest(ctx, header))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	err = auth.Authorize(p, g.policy)
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return p, nil
+}
+
+// httpRequest returns the call as the authenticators expect it, with its
+// metadata as headers. The gRPC server is plaintext, so calls carry no client
+// certificate.
+func httpRequest(ctx context.Context, header http.Header) *http.Request {
+	r := (&http.Request{URL: &url.URL{}, Header: header}).WithContext(ctx)
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	return r
+}
@@ -0,0 +1,224 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/ransoor2/ip2country/api/proto/v1"
+	"github.com/ransoor2/ip2country/internal/controller/limit"
+	"github.com/ransoor2/ip2country/internal/geopolicy"
+	"github.com/ransoor2/ip2country/pkg/ipfilter"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+// errSkip marks calls from allowed networks that bypass the rate limiter.
+var errSkip = errors.New("rate limiter bypassed")
+
+// methodCosts holds the cost of methods by full method name, as a function of
+// their request. Methods without one cost a request per call, or per message
+// received on streams.
+type methodCosts map[string]func(req any) int
+
+func (mc methodCosts) cost(method string, req any) int {
+	if cost, ok := mc[method]; ok {
+		return cost(req)
+	}
+
+	return 1
+}
+
+// guard applies the IP filter, the lookup policy, the geo policies and the
+// rate limits to the calls of the IP2Country service. Health checks and
+// reflection are exempt.
+type guard struct {
+	ip2Country    IP2CountryService
+	rateLimiter   RateLimiter
+	keyer         Keyer
+	authenticator Authenticator
+	policy        string
+	ipFilter      IPFilter
+	geoPolicies   GeoPolicies
+	costs         methodCosts
+}
+
+func (g *guard) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !guarded(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	limitReq, err := g.request(ctx)
+	switch {
+	case errors.Is(err, errSkip):
+		return handler(ctx, req)
+	case err != nil:
+		return nil, err
+	}
+
+	limitReq.Cost = g.costs.cost(info.FullMethod, req)
+	decision := g.rateLimiter.Allow(ctx, limitReq)
+	if err := grpc.SetHeader(ctx, rateLimitMD(decision)); err != nil {
+		return nil, err
+	}
+	if !decision.Allowed {
+		return nil, rejected(ctx, limitReq.Cost, decision)
+	}
+
+	return handler(ctx, req)
+}
+
+func (g *guard) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !guarded(info.FullMethod) {
+		return handler(srv, ss)
+	}
+
+	limitReq, err := g.request(ss.Context())
+	switch {
+	case errors.Is(err, errSkip):
+		return handler(srv, ss)
+	case err != nil:
+		return err
+	}
+
+	return handler(srv, &limitedStream{ServerStream: ss, guard: g, method: info.FullMethod, req: limitReq})
+}
+
+// limitedStream charges every message received on the stream to the rate limiter.
+type limitedStream struct {
+	grpc.ServerStream
+	guard  *guard
+	method string
+	req    ratelimiter.Request
+}
+
+func (s *limitedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	req := s.req
+	req.Cost = s.guard.costs.cost(s.method, m)
+	decision := s.guard.rateLimiter.Allow(s.Context(), req)
+	if !decision.Allowed {
+		return rejected(s.Context(), req.Cost, decision)
+	}
+
+	return nil
+}
+
+// request returns the rate limited request of the call, see limit.Request, or
+// the status error rejecting it. It returns errSkip for calls from allowed
+// networks that bypass the rate limiter.
+func (g *guard) request(ctx context.Context) (ratelimiter.Request, error) {
+	ip := clientIP(ctx)
+
+	allowlisted := false
+	switch g.ipFilter.Match(ip) {
+	case ipfilter.Deny:
+		return ratelimiter.Request{}, status.Error(codes.PermissionDenied, "forbidden")
+	case ipfilter.Allow:
+		allowlisted = true
+	case ipfilter.None:
+	}
+
+	header := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		header[http.CanonicalHeaderKey(k)] = v
+	}
+
+	p, err := g.authenticate(ctx, header)
+	if err != nil {
+		return ratelimiter.Request{}, err
+	}
+
+	var geoLimit *ratelimiter.Limit
+	if !allowlisted && !g.geoPolicies.Empty() {
+		// Clients whose country is unknown only match the catch-all policy
+		country, _, _ := g.ip2Country.IP2CountryNCity(ctx, ip)
+		policy := g.geoPolicies.Match(country)
+		switch {
+		case policy == nil:
+		case policy.Action == geopolicy.Block:
+			return ratelimiter.Request{}, status.Error(codes.PermissionDenied, "forbidden")
+		case policy.Limit != nil:
+			geoLimit = policy.Limit
+		}
+	}
+
+	req, ok := limit.Request(limit.Client{
+		IP:          ip,
+		Header:      header,
+		Principal:   p,
+		Allowlisted: allowlisted,
+		GeoLimit:    geoLimit,
+	}, g.keyer, g.ipFilter.AllowLimit())
+	if !ok {
+		return ratelimiter.Request{}, errSkip
+	}
+
+	return req, nil
+}
+
+// guarded reports whether method belongs to the IP2Country service.
+func guarded(method string) bool {
+	return strings.HasPrefix(method, "/"+pb.IP2Country_ServiceDesc.ServiceName+"/")
+}
+
+// clientIP returns the IP address of the caller.
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// rateLimitMD reports the client's standing in the same headers as the HTTP API.
+func rateLimitMD(decision ratelimiter.Decision) metadata.MD {
+	md := metadata.Pairs(
+		"ratelimit-limit", strconv.Itoa(decision.Limit),
+		"ratelimit-remaining", strconv.Itoa(decision.Remaining),
+		"ratelimit-reset", seconds(decision.Reset),
+	)
+	if !decision.Allowed && !decision.CostExceedsLimit {
+		md.Set("retry-after", seconds(max(decision.RetryAfter, time.Second)))
+	}
+
+	return md
+}
+
+// rejected returns the status of a call of cost requests rejected by the rate
+// limiter, telling how long to wait in its trailer. Calls costing more than
+// the limit are invalid rather than to be retried.
+func rejected(ctx context.Context, cost int, decision ratelimiter.Decision) error {
+	if decision.CostExceedsLimit {
+		return status.Errorf(codes.InvalidArgument, "request costs %d requests, more than the limit of %d", cost, decision.Limit)
+	}
+
+	_ = grpc.SetTrailer(ctx, rateLimitMD(decision))
+
+	return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+}
+
+// seconds formats d as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
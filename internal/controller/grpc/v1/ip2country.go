@@ -0,0 +1,101 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/ransoor2/ip2country/api/proto/v1"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+// maxBatchSize is the maximum number of addresses of a BatchLookup call.
+const maxBatchSize = 1000
+
+type ip2CountryServer struct {
+	pb.UnimplementedIP2CountryServer
+	ip2Country IP2CountryService
+	logger     logger.Interface
+}
+
+func newIP2CountryServer(t IP2CountryService, l logger.Interface) *ip2CountryServer {
+	return &ip2CountryServer{ip2Country: t, logger: l}
+}
+
+func (s *ip2CountryServer) Lookup(ctx context.Context, req *pb.LookupRequest) (*pb.LookupResponse, error) {
+	country, city, err := s.lookup(ctx, req.GetIp())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.LookupResponse{Country: country, City: city}, nil
+}
+
+func (s *ip2CountryServer) BatchLookup(ctx context.Context, req *pb.BatchLookupRequest) (*pb.BatchLookupResponse, error) {
+	if len(req.GetIps()) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d IP addresses per batch", maxBatchSize)
+	}
+
+	resp := &pb.BatchLookupResponse{Results: make([]*pb.LookupResult, 0, len(req.GetIps()))}
+	for _, ip := range req.GetIps() {
+		resp.Results = append(resp.Results, s.result(ctx, ip))
+	}
+
+	return resp, nil
+}
+
+func (s *ip2CountryServer) StreamLookup(stream grpc.BidiStreamingServer[pb.LookupRequest, pb.LookupResult]) error {
+	for {
+		req, err := stream.Recv()
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if err := stream.Send(s.result(stream.Context(), req.GetIp())); err != nil {
+			return err
+		}
+	}
+}
+
+// result returns the result of ip for batches and streams, where a failed
+// lookup doesn't fail the others.
+func (s *ip2CountryServer) result(ctx context.Context, ip string) *pb.LookupResult {
+	country, city, err := s.lookup(ctx, ip)
+	if err != nil {
+		st := status.Convert(err)
+		return &pb.LookupResult{Ip: ip, Error: &pb.Error{Code: int32(st.Code()), Message: st.Message()}}
+	}
+
+	return &pb.LookupResult{Ip: ip, Country: country, City: city}
+}
+
+// lookup returns the location of ip, or the status error of the lookup.
+func (s *ip2CountryServer) lookup(ctx context.Context, ip string) (country, city string, err error) {
+	if ip == "" {
+		return "", "", status.Error(codes.InvalidArgument, "ip is required")
+	}
+
+	if net.ParseIP(ip) == nil {
+		return "", "", status.Error(codes.InvalidArgument, "invalid IP address format")
+	}
+
+	country, city, err = s.ip2Country.IP2CountryNCity(ctx, ip)
+	if err != nil {
+		s.logger.Error("error finding country", "grpc - v1 - lookup", "error", err)
+		return "", "", status.Error(codes.Internal, "error finding country")
+	}
+
+	if country == "" && city == "" {
+		return "", "", status.Error(codes.NotFound, "country and city not found")
+	}
+
+	return country, city, nil
+}
@@ -0,0 +1,79 @@
+// Package v1 implements the gRPC services. Each services in own file.
+package v1
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	pb "github.com/ransoor2/ip2country/api/proto/v1"
+	"github.com/ransoor2/ip2country/internal/geopolicy"
+	"github.com/ransoor2/ip2country/pkg/ipfilter"
+	"github.com/ransoor2/ip2country/pkg/logger"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+type IP2CountryService interface {
+	IP2CountryNCity(context.Context, string) (string, string, error)
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, req ratelimiter.Request) ratelimiter.Decision
+}
+
+type IPFilter interface {
+	Match(ip string) ipfilter.Action
+	AllowLimit() *ratelimiter.Limit
+}
+
+type Keyer interface {
+	Keys(c ratelimiter.Client) []ratelimiter.KeyLimit
+}
+
+type GeoPolicies interface {
+	Empty() bool
+	Match(country string) *geopolicy.Policy
+}
+
+// NewRouter returns a gRPC server of the v1 services, along with standard
+// health checking by healthServer and reflection. Calls go through the same IP
+// filter, authentication, lookup policy, geo policies and rate limits as the
+// HTTP API.
+func NewRouter(l logger.Interface, healthServer *health.Server, ip2CountryService IP2CountryService, rateLimiter RateLimiter,
+	keyer Keyer, authenticator Authenticator, policy string, ipFilter IPFilter, geoPolicies GeoPolicies) *grpc.Server {
+	g := &guard{
+		ip2Country:    ip2CountryService,
+		rateLimiter:   rateLimiter,
+		keyer:         keyer,
+		authenticator: authenticator,
+		policy:        policy,
+		ipFilter:      ipFilter,
+		geoPolicies:   geoPolicies,
+		costs: methodCosts{
+			// Oversized batches, which the handler rejects, cost a single request
+			pb.IP2Country_BatchLookup_FullMethodName: func(req any) int {
+				if n := len(req.(*pb.BatchLookupRequest).GetIps()); n <= maxBatchSize {
+					return n
+				}
+				return 1
+			},
+		},
+	}
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(g.unary),
+		grpc.ChainStreamInterceptor(g.stream),
+	)
+
+	pb.RegisterIP2CountryServer(server, newIP2CountryServer(ip2CountryService, l))
+
+	healthServer.SetServingStatus(pb.IP2Country_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+
+	return server
+}
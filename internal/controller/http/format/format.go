@@ -0,0 +1,185 @@
+// Package format negotiates the format of responses, from the format query
+// parameter or the Accept header, and renders them in it.
+package format
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Formats, as named by the format query parameter.
+const (
+	JSON    = "json"
+	XML     = "xml"
+	CSV     = "csv"
+	MsgPack = "msgpack"
+	Text    = "text"
+)
+
+// formatKey holds the negotiated format in the gin context.
+const formatKey = "format"
+
+// Tabular is a response that can be rendered as CSV, a header row followed by
+// the records.
+type Tabular interface {
+	CSV() [][]string
+}
+
+// Texter is a response that can be rendered as plain text.
+type Texter interface {
+	Text() string
+}
+
+// mediaType is a media type of a format. Wildcards of the Accept header match
+// the first media type of their type.
+type mediaType struct {
+	mime   string
+	format string
+}
+
+var mediaTypes = []mediaType{
+	{"application/json", JSON},
+	{"application/xml", XML},
+	{"application/msgpack", MsgPack},
+	{"application/x-msgpack", MsgPack},
+	{"application/vnd.msgpack", MsgPack},
+	{"text/plain", Text},
+	{"text/csv", CSV},
+	{"text/xml", XML},
+}
+
+var formats = map[string]bool{JSON: true, XML: true, CSV: true, MsgPack: true, Text: true}
+
+// Negotiate picks the format of the response from the format query parameter,
+// or else the most preferred format of the Accept header, JSON by default.
+// Clients asking for an unknown format get 406 Not Acceptable, rendered as
+// JSON with onError. Accept headers without a supported type fall back to
+// JSON rather than being rejected, as browsers and HTTP libraries send all
+// kinds of them.
+func Negotiate(onError func(c *gin.Context, code int, msg string)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if f := c.Query("format"); f != "" {
+			if !formats[f] {
+				onError(c, http.StatusNotAcceptable, "unsupported format, expected one of json, xml, csv, msgpack or text")
+				return
+			}
+			c.Set(formatKey, f)
+			c.Next()
+			return
+		}
+
+		// Only responses negotiated by the Accept header vary by it, the format
+		// parameter is part of the URL that caches key responses by
+		c.Writer.Header().Add("Vary", "Accept")
+		c.Set(formatKey, accepted(c.GetHeader("Accept")))
+		c.Next()
+	}
+}
+
+// Get returns the negotiated format of the request, JSON if it wasn't negotiated.
+func Get(c *gin.Context) string {
+	if f := c.GetString(formatKey); f != "" {
+		return f
+	}
+
+	return JSON
+}
+
+// Render writes obj in the negotiated format. CSV and plain text need obj to
+// implement Tabular and Texter, other responses are rendered as JSON.
+func Render(c *gin.Context, code int, obj any) {
+	switch Get(c) {
+	case XML:
+		c.XML(code, obj)
+	case MsgPack:
+		c.Render(code, render.MsgPack{Data: obj})
+	case CSV:
+		t, ok := obj.(Tabular)
+		if !ok {
+			c.JSON(code, obj)
+			return
+		}
+		c.Status(code)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		_ = w.WriteAll(t.CSV())
+	case Text:
+		t, ok := obj.(Texter)
+		if !ok {
+			c.JSON(code, obj)
+			return
+		}
+		c.String(code, "%s\n", t.Text())
+	default:
+		c.JSON(code, obj)
+	}
+}
+
+// Abort aborts the request with obj as its response, in the negotiated format.
+func Abort(c *gin.Context, code int, obj any) {
+	c.Abort()
+	Render(c, code, obj)
+}
+
+// accepted returns the format of the most preferred media type of the Accept
+// header, in the order of the header among equally preferred ones.
+func accepted(header string) string {
+	best, bestQ := JSON, 0.0
+	for _, part := range strings.Split(header, ",") {
+		mime, params, _ := strings.Cut(part, ";")
+		mime = strings.ToLower(strings.TrimSpace(mime))
+		if mime == "" {
+			continue
+		}
+
+		q := quality(params)
+		if q <= bestQ {
+			continue
+		}
+		if f, ok := match(mime); ok {
+			best, bestQ = f, q
+		}
+	}
+
+	return best
+}
+
+// match returns the format of mime, which may be a wildcard.
+func match(mime string) (string, bool) {
+	if mime == "*/*" {
+		return JSON, true
+	}
+
+	for _, t := range mediaTypes {
+		if t.mime == mime {
+			return t.format, true
+		}
+		if prefix, ok := strings.CutSuffix(mime, "/*"); ok && strings.HasPrefix(t.mime, prefix+"/") {
+			return t.format, true
+		}
+	}
+
+	return "", false
+}
+
+// quality returns the q parameter of a media range, 1 if it has none.
+func quality(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		name, value, _ := strings.Cut(param, "=")
+		if strings.TrimSpace(name) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 0
+		}
+		return q
+	}
+
+	return 1
+}
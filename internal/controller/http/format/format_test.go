@@ -0,0 +1,36 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccepted(t *testing.T) {
+	tests := []struct {
+		header string
+		format string
+	}{
+		{"", JSON},
+		{"*/*", JSON},
+		{"application/json", JSON},
+		{"application/xml", XML},
+		{"text/xml", XML},
+		{"text/csv", CSV},
+		{"application/msgpack", MsgPack},
+		{"application/x-msgpack", MsgPack},
+		{"text/plain", Text},
+		{"text/*", Text},
+		{"Text/CSV; charset=utf-8", CSV},
+		{"text/html", JSON},
+		{"text/html, text/csv", CSV},
+		{"text/csv;q=0.5, application/xml", XML},
+		{"text/csv, application/xml", CSV},
+		{"application/xml;q=0, text/plain;q=0.1", Text},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", XML},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.format, accepted(tc.header), tc.header)
+	}
+}
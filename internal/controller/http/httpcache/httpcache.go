@@ -0,0 +1,113 @@
+// Package httpcache sets the HTTP caching headers of lookups, and answers
+// conditional requests for them.
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/auth"
+	"github.com/ransoor2/ip2country/internal/controller/http/format"
+)
+
+type Versioner interface {
+	DatasetVersion() string
+}
+
+// Policy caches lookups, whose results only change along with the dataset,
+// for the configured max age. Their strong ETag is derived from the dataset
+// version and the IP, so clients and CDNs revalidate them without a lookup.
+type Policy struct {
+	cacheControl string
+	version      func() string
+}
+
+// New returns the policy of cfg. The dataset version of cfg takes precedence
+// over the one of v, and lookups have no ETag if neither is known. Lookups
+// that aren't public under lookupPolicy are only cached by clients, so that
+// shared caches don't serve them to clients without credentials.
+func New(cfg config.HTTPCache, v Versioner, lookupPolicy string) *Policy {
+	p := &Policy{
+		cacheControl: "no-cache",
+		version:      v.DatasetVersion,
+	}
+	if cfg.MaxAge > 0 {
+		visibility := "public"
+		if lookupPolicy != "" && lookupPolicy != auth.Public {
+			visibility = "private"
+		}
+		p.cacheControl = visibility + ", max-age=" + strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	if cfg.DatasetVersion != "" {
+		p.version = func() string { return cfg.DatasetVersion }
+	}
+
+	return p
+}
+
+// NotModified answers the request with 304 Not Modified if the client's copy
+// of the lookup of key (the IP, and whatever else selects the response) is
+// current. Handlers are done with the request when it returns true.
+func (p *Policy) NotModified(c *gin.Context, key ...string) bool {
+	etag := p.etag(c, key)
+	if etag == "" || !match(c.GetHeader("If-None-Match"), etag) {
+		return false
+	}
+
+	p.setHeaders(c, etag)
+	c.AbortWithStatus(http.StatusNotModified)
+
+	return true
+}
+
+// Cache sets the caching headers of a successful lookup of key.
+func (p *Policy) Cache(c *gin.Context, key ...string) {
+	p.setHeaders(c, p.etag(c, key))
+}
+
+func (p *Policy) setHeaders(c *gin.Context, etag string) {
+	c.Header("Cache-Control", p.cacheControl)
+	if etag != "" {
+		c.Header("ETag", etag)
+	}
+}
+
+// etag returns the ETag of the lookup of key. Representations differ in bytes
+// by route and format, so they are part of it too.
+func (p *Policy) etag(c *gin.Context, key []string) string {
+	version := p.version()
+	if version == "" {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, part := range append([]string{version, c.FullPath(), format.Get(c)}, key...) {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// match reports whether the If-None-Match header matches etag, by the weak
+// comparison of RFC 9110.
+func match(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
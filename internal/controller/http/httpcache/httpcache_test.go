@@ -0,0 +1,91 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/auth"
+)
+
+type version string
+
+func (v version) DatasetVersion() string {
+	return string(v)
+}
+
+// serve returns the response of a lookup of ip through p.
+func serve(p *Policy, ip, ifNoneMatch string) *httptest.ResponseRecorder {
+	handler := gin.New()
+	handler.GET("/ip/:ip", func(c *gin.Context) {
+		if p.NotModified(c, c.Param("ip")) {
+			return
+		}
+		p.Cache(c, c.Param("ip"))
+		c.String(http.StatusOK, "location")
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ip/"+ip, http.NoBody)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	handler.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestPolicy(t *testing.T) {
+	p := New(config.HTTPCache{MaxAge: time.Hour}, version("v1"), auth.Public)
+
+	w := serve(p, "1.1.1.1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=3600", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+
+	w = serve(p, "1.1.1.1", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, "public, max-age=3600", w.Header().Get("Cache-Control"))
+
+	assert.Equal(t, http.StatusNotModified, serve(p, "1.1.1.1", `"other", W/`+etag).Code)
+	assert.Equal(t, http.StatusNotModified, serve(p, "1.1.1.1", "*").Code)
+
+	// ETags differ by IP and dataset version
+	assert.Equal(t, http.StatusOK, serve(p, "8.8.8.8", etag).Code)
+	assert.Equal(t, http.StatusOK, serve(New(config.HTTPCache{MaxAge: time.Hour}, version("v2"), auth.Public), "1.1.1.1", etag).Code)
+
+	// The configured dataset version takes precedence
+	p = New(config.HTTPCache{MaxAge: time.Hour, DatasetVersion: "v1"}, version("v2"), auth.Public)
+	assert.Equal(t, etag, serve(p, "1.1.1.1", "").Header().Get("ETag"))
+}
+
+func TestPolicyAuthenticated(t *testing.T) {
+	// Lookups served to authenticated principals are kept out of shared caches
+	for _, policy := range []string{auth.Authenticated, "geo-reader"} {
+		p := New(config.HTTPCache{MaxAge: time.Hour}, version("v1"), policy)
+
+		w := serve(p, "1.1.1.1", "")
+		assert.Equal(t, "private, max-age=3600", w.Header().Get("Cache-Control"), policy)
+
+		w = serve(p, "1.1.1.1", w.Header().Get("ETag"))
+		assert.Equal(t, http.StatusNotModified, w.Code, policy)
+		assert.Equal(t, "private, max-age=3600", w.Header().Get("Cache-Control"), policy)
+	}
+}
+
+func TestPolicyWithoutVersion(t *testing.T) {
+	p := New(config.HTTPCache{}, version(""), auth.Public)
+
+	w := serve(p, "1.1.1.1", "*")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.Empty(t, w.Header().Get("ETag"))
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ransoor2/ip2country/internal/auth"
+)
+
+// principalKey holds the authenticated principal in the gin context.
+const principalKey = "principal"
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (*auth.Principal, error)
+}
+
+// Authenticate identifies the principal of requests, which rate limiting and
+// logs then use, and rejects requests carrying invalid credentials. Requests
+// without credentials go on anonymously. Requests already authenticated by an
+// enclosing group are not authenticated again.
+func Authenticate(a Authenticator, onError ErrorFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(principalKey); ok {
+			c.Next()
+			return
+		}
+
+		p, err := a.Authenticate(c.Request)
+		if err != nil {
+			onError(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// Authorize rejects requests whose principal doesn't satisfy policy, see auth.Authorize.
+func Authorize(policy string, onError ErrorFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := auth.Authorize(GetPrincipal(c), policy)
+		switch {
+		case errors.Is(err, auth.ErrUnauthenticated):
+			c.Header("WWW-Authenticate", "Bearer")
+			onError(c, http.StatusUnauthorized, err.Error())
+			return
+		case err != nil:
+			onError(c, http.StatusForbidden, err.Error())
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetPrincipal returns the principal of the request, nil if it is anonymous.
+func GetPrincipal(c *gin.Context) *auth.Principal {
+	v, _ := c.Get(principalKey)
+	p, _ := v.(*auth.Principal)
+	return p
+}
+
+// AccessLog logs requests like gin.Logger, along with their principal. The
+// values of the redacted query parameters, which carry credentials, are masked.
+func AccessLog(redacted ...string) gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		principal := "-"
+		if p, _ := param.Keys[principalKey].(*auth.Principal); p != nil {
+			principal = p.ID()
+		}
+
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %s | %-7s %#v\n%s",
+			param.TimeStamp.Format(time.RFC3339),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			principal,
+			param.Method,
+			redactQuery(param.Path, redacted),
+			param.ErrorMessage,
+		)
+	})
+}
+
+// redactQuery masks the values of the params in the query string of path,
+// leaving the rest of it as sent.
+func redactQuery(path string, params []string) string {
+	base, query, ok := strings.Cut(path, "?")
+	if !ok || len(params) == 0 {
+		return path
+	}
+
+	fields := strings.Split(query, "&")
+	for i, field := range fields {
+		name, _, _ := strings.Cut(field, "=")
+		if name, err := url.QueryUnescape(name); err == nil && slices.Contains(params, name) {
+			fields[i] = name + "=REDACTED"
+		}
+	}
+
+	return base + "?" + strings.Join(fields, "&")
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogRedactsCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var log bytes.Buffer
+	defaultWriter := gin.DefaultWriter
+	gin.DefaultWriter = &log
+	t.Cleanup(func() { gin.DefaultWriter = defaultWriter })
+
+	handler := gin.New()
+	handler.Use(AccessLog("api_key"))
+	handler.GET("/ip", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, uri := range []string{"/ip?ip=8.8.8.8&api_key=secret", "/ip?api%5Fkey=secret&ip=8.8.8.8"} {
+		log.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, uri, http.NoBody))
+
+		assert.NotContains(t, log.String(), "secret", uri)
+		assert.Contains(t, log.String(), "api_key=REDACTED", uri)
+		assert.Contains(t, log.String(), "ip=8.8.8.8", uri)
+	}
+}
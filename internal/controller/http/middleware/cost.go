@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"path"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CostFunc returns the number of requests a request counts for against its limits.
+type CostFunc func(c *gin.Context) int
+
+// Weight is the cost of routes charging n requests for every request.
+func Weight(n int) CostFunc {
+	return func(*gin.Context) int { return n }
+}
+
+// RouteCosts holds the cost of routes, by method and full path.
+type RouteCosts map[string]CostFunc
+
+// Handle registers handler for a route of g, charging requests their cost.
+func (rc RouteCosts) Handle(g *gin.RouterGroup, method, relativePath string, cost CostFunc, handler gin.HandlerFunc) {
+	g.Handle(method, relativePath, handler)
+	rc[method+" "+path.Join(g.BasePath(), relativePath)] = cost
+}
+
+// Cost returns the cost of the request, 1 for routes without one.
+func (rc RouteCosts) Cost(c *gin.Context) int {
+	if cost, ok := rc[c.Request.Method+" "+c.FullPath()]; ok {
+		return cost(c)
+	}
+
+	return 1
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var shedRequests = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "http_requests_shed_total",
+	Help: "The number of requests rejected because the server was serving the maximum number of requests at once.",
+})
+
+// InFlight bounds the requests served at once, across the versions of the API.
+type InFlight struct {
+	slots chan struct{}
+}
+
+// NewInFlight returns a bound of max requests at once, none if max is 0.
+func NewInFlight(max int) *InFlight {
+	if max <= 0 {
+		return &InFlight{}
+	}
+
+	return &InFlight{slots: make(chan struct{}, max)}
+}
+
+// Limit sheds the requests beyond the bound with 503 Service Unavailable
+// rather than queueing them, so that a saturated server keeps its latency and
+// clients retry elsewhere or later.
+func (f *InFlight) Limit(onError ErrorFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if f.slots == nil {
+			c.Next()
+			return
+		}
+
+		select {
+		case f.slots <- struct{}{}:
+			defer func() { <-f.slots }()
+			c.Next()
+		default:
+			shedRequests.Inc()
+			c.Header("Retry-After", "1")
+			onError(c, http.StatusServiceUnavailable, "server is saturated")
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInFlight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	onError := func(c *gin.Context, code int, msg string) {
+		c.AbortWithStatusJSON(code, gin.H{"error": msg})
+	}
+	// Blocks the first request until released
+	entered, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	handler := gin.New()
+	handler.Use(NewInFlight(1).Limit(onError))
+	handler.GET("/", func(c *gin.Context) {
+		once.Do(func() {
+			close(entered)
+			<-release
+		})
+		c.Status(http.StatusOK)
+	})
+
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+		return rec
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- serve() }()
+	<-entered
+
+	// Shed while the first request holds the only slot
+	rec := serve()
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-first).Code)
+
+	// The slot is released
+	assert.Equal(t, http.StatusOK, serve().Code)
+}
+
+func TestInFlightUnbounded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := gin.New()
+	handler.Use(NewInFlight(0).Limit(nil))
+	handler.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
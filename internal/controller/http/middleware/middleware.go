@@ -0,0 +1,140 @@
+// Package middleware implements the middlewares shared by the versions of the HTTP API.
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ransoor2/ip2country/internal/controller/limit"
+	"github.com/ransoor2/ip2country/internal/geopolicy"
+	"github.com/ransoor2/ip2country/pkg/ipfilter"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+type IP2CountryService interface {
+	IP2CountryNCity(context.Context, string) (string, string, error)
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, req ratelimiter.Request) ratelimiter.Decision
+}
+
+type IPFilter interface {
+	Match(ip string) ipfilter.Action
+	AllowLimit() *ratelimiter.Limit
+}
+
+type Keyer interface {
+	Keys(c ratelimiter.Client) []ratelimiter.KeyLimit
+}
+
+type GeoPolicies interface {
+	Empty() bool
+	Match(country string) *geopolicy.Policy
+}
+
+// ErrorFunc aborts the request with the error response of the API version.
+type ErrorFunc func(c *gin.Context, code int, msg string)
+
+const (
+	// allowlistedKey marks requests from allowed networks in the gin context.
+	allowlistedKey = "allowlisted"
+	// geoLimitKey holds the limit of the client's country in the gin context.
+	geoLimitKey = "geoLimit"
+)
+
+// FilterIPs rejects requests from denied networks and marks those from
+// allowed networks for the rate limiter.
+func FilterIPs(f IPFilter, onError ErrorFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch f.Match(c.ClientIP()) {
+		case ipfilter.Deny:
+			onError(c, http.StatusForbidden, "forbidden")
+			return
+		case ipfilter.Allow:
+			c.Set(allowlistedKey, true)
+		case ipfilter.None:
+		}
+		c.Next()
+	}
+}
+
+// ApplyGeoPolicies resolves the client's country and applies its policy:
+// blocked countries are rejected, and limited ones get their limit from the
+// rate limiter. Requests from allowed networks are exempt.
+func ApplyGeoPolicies(s IP2CountryService, policies GeoPolicies, onError ErrorFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(allowlistedKey) {
+			c.Next()
+			return
+		}
+
+		// Clients whose country is unknown only match the catch-all policy
+		country, _, _ := s.IP2CountryNCity(c.Request.Context(), c.ClientIP())
+
+		policy := policies.Match(country)
+		switch {
+		case policy == nil:
+		case policy.Action == geopolicy.Block:
+			onError(c, http.StatusForbidden, "forbidden")
+			return
+		case policy.Limit != nil:
+			c.Set(geoLimitKey, policy.Limit)
+		}
+		c.Next()
+	}
+}
+
+// Limit limits requests as limit.Request does, charging them the cost of their
+// route. It reports the client's standing in the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers (IETF draft) on every
+// response, and how long to wait in Retry-After once it is rejected. It runs
+// after Authenticate, from which it gets the principal.
+func Limit(rl RateLimiter, keyer Keyer, ipFilter IPFilter, costs RouteCosts, onError ErrorFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var geoLimit *ratelimiter.Limit
+		if v, ok := c.Get(geoLimitKey); ok {
+			geoLimit, _ = v.(*ratelimiter.Limit)
+		}
+		req, ok := limit.Request(limit.Client{
+			IP:          c.ClientIP(),
+			Header:      c.Request.Header,
+			Principal:   GetPrincipal(c),
+			Allowlisted: c.GetBool(allowlistedKey),
+			GeoLimit:    geoLimit,
+		}, keyer, ipFilter.AllowLimit())
+		if !ok {
+			c.Next()
+			return
+		}
+		req.Cost = costs.Cost(c)
+
+		decision := rl.Allow(c.Request.Context(), req)
+
+		c.Header("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		c.Header("RateLimit-Reset", seconds(decision.Reset))
+
+		if decision.CostExceedsLimit {
+			onError(c, http.StatusBadRequest, fmt.Sprintf("request costs %d requests, more than the limit of %d", req.Cost, decision.Limit))
+			return
+		}
+		if !decision.Allowed {
+			c.Header("Retry-After", seconds(max(decision.RetryAfter, time.Second)))
+			onError(c, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
+
+// seconds formats d as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,221 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
+	"github.com/ransoor2/ip2country/pkg/logger"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+const (
+	defaultTopConsumers = 10
+	maxTopConsumers     = 1000
+)
+
+type RateLimiterAdmin interface {
+	Inspect(ctx context.Context, key string) (ratelimiter.KeyState, error)
+	TopConsumers(ctx context.Context, n int) ([]ratelimiter.KeyState, error)
+	Reset(ctx context.Context, key string) error
+	Limits() ratelimiter.Limits
+	SetLimits(ctx context.Context, l ratelimiter.Limits) error
+}
+
+type keyStateResponse struct {
+	Key        string     `json:"key"`
+	Limit      int        `json:"limit"`
+	Remaining  int        `json:"remaining"`
+	Reset      string     `json:"reset"`
+	LastRefill *time.Time `json:"lastRefill,omitempty"`
+	TTL        string     `json:"ttl"`
+}
+
+type limitsResponse struct {
+	MaxRequests  int    `json:"maxRequests"`
+	UserRequests int    `json:"userRequests"`
+	Interval     string `json:"interval"`
+}
+
+// limitsRequest changes the limits that are set, and keeps the others.
+type limitsRequest struct {
+	MaxRequests  *int    `json:"maxRequests" binding:"omitempty,min=1"`
+	UserRequests *int    `json:"userRequests" binding:"omitempty,min=1"`
+	Interval     *string `json:"interval"`
+}
+
+type adminRoutes struct {
+	rateLimiter RateLimiterAdmin
+	logger      logger.Interface
+}
+
+// NewAdminRouter registers the admin endpoints, which inspect and tune the
+// rate limiter at runtime, under /admin. Requests must satisfy policy, the
+// admin role by default, and changes are audit logged with their principal.
+func NewAdminRouter(handler *gin.Engine, l logger.Interface, rateLimiter RateLimiterAdmin,
+	authenticator middleware.Authenticator, policy string) {
+	r := &adminRoutes{rateLimiter: rateLimiter, logger: l}
+
+	adminGroup := handler.Group("/admin")
+	adminGroup.Use(middleware.Authenticate(authenticator, errorResponse))
+	adminGroup.Use(middleware.Authorize(policy, errorResponse))
+
+	adminGroup.GET("/ratelimiter/keys/*key", r.inspect)
+	adminGroup.DELETE("/ratelimiter/keys/*key", r.reset)
+	adminGroup.GET("/ratelimiter/top", r.topConsumers)
+	adminGroup.GET("/ratelimiter/limits", r.limits)
+	adminGroup.PATCH("/ratelimiter/limits", r.setLimits)
+}
+
+// inspect reports the bucket of a key, e.g. a client IP or "key:<name>" for API keys.
+func (r *adminRoutes) inspect(c *gin.Context) {
+	key, ok := keyParam(c)
+	if !ok {
+		return
+	}
+
+	state, err := r.rateLimiter.Inspect(c.Request.Context(), key)
+	switch {
+	case errors.Is(err, ratelimiter.ErrNotFound):
+		errorResponse(c, http.StatusNotFound, "key not found")
+		return
+	case err != nil:
+		r.logger.Error(err, "http - v1 - admin - inspect")
+		errorResponse(c, http.StatusInternalServerError, "error inspecting key")
+		return
+	}
+
+	c.JSON(http.StatusOK, newKeyStateResponse(state))
+}
+
+// reset drops the bucket of a key, so that its next request starts afresh.
+func (r *adminRoutes) reset(c *gin.Context) {
+	key, ok := keyParam(c)
+	if !ok {
+		return
+	}
+
+	err := r.rateLimiter.Reset(c.Request.Context(), key)
+	switch {
+	case errors.Is(err, ratelimiter.ErrNotFound):
+		errorResponse(c, http.StatusNotFound, "key not found")
+		return
+	case err != nil:
+		r.logger.Error(err, "http - v1 - admin - reset")
+		errorResponse(c, http.StatusInternalServerError, "error resetting key")
+		return
+	}
+
+	r.logger.Info("http - v1 - admin - audit: %s from %s reset key %q", actor(c), c.ClientIP(), key)
+	c.Status(http.StatusNoContent)
+}
+
+// topConsumers reports the n keys that used the most of their limit, 10 by default.
+func (r *adminRoutes) topConsumers(c *gin.Context) {
+	n := defaultTopConsumers
+	if param := c.Query("n"); param != "" {
+		var err error
+		n, err = strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxTopConsumers {
+			errorResponse(c, http.StatusBadRequest, "n must be between 1 and "+strconv.Itoa(maxTopConsumers))
+			return
+		}
+	}
+
+	states, err := r.rateLimiter.TopConsumers(c.Request.Context(), n)
+	if err != nil {
+		r.logger.Error(err, "http - v1 - admin - topConsumers")
+		errorResponse(c, http.StatusInternalServerError, "error listing top consumers")
+		return
+	}
+
+	resp := make([]keyStateResponse, 0, len(states))
+	for _, state := range states {
+		resp = append(resp, newKeyStateResponse(state))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (r *adminRoutes) limits(c *gin.Context) {
+	c.JSON(http.StatusOK, newLimitsResponse(r.rateLimiter.Limits()))
+}
+
+// setLimits changes the global and per client limits without a restart.
+func (r *adminRoutes) setLimits(c *gin.Context) {
+	var req limitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		errorResponse(c, http.StatusBadRequest, "invalid limits: "+err.Error())
+		return
+	}
+
+	old := r.rateLimiter.Limits()
+	limits := old
+	if req.MaxRequests != nil {
+		limits.MaxRequests = *req.MaxRequests
+	}
+	if req.UserRequests != nil {
+		limits.UserRequests = *req.UserRequests
+	}
+	if req.Interval != nil {
+		interval, err := time.ParseDuration(*req.Interval)
+		if err != nil || interval <= 0 {
+			errorResponse(c, http.StatusBadRequest, "invalid limits: interval must be a positive duration")
+			return
+		}
+		limits.Interval = interval
+	}
+
+	if err := r.rateLimiter.SetLimits(c.Request.Context(), limits); err != nil {
+		r.logger.Error(err, "http - v1 - admin - setLimits")
+		errorResponse(c, http.StatusInternalServerError, "error setting limits")
+		return
+	}
+	r.logger.Info("http - v1 - admin - audit: %s from %s changed limits from %+v to %+v", actor(c), c.ClientIP(), old, limits)
+
+	c.JSON(http.StatusOK, newLimitsResponse(limits))
+}
+
+// actor identifies the principal behind an admin request in audit logs.
+func actor(c *gin.Context) string {
+	if p := middleware.GetPrincipal(c); p != nil {
+		return p.ID()
+	}
+
+	return "anonymous"
+}
+
+// keyParam returns the key of the request's path, or rejects the request if there is none.
+func keyParam(c *gin.Context) (string, bool) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if key == "" {
+		errorResponse(c, http.StatusBadRequest, "key is required")
+		return "", false
+	}
+
+	return key, true
+}
+
+func newKeyStateResponse(s ratelimiter.KeyState) keyStateResponse {
+	resp := keyStateResponse{
+		Key:       s.Key,
+		Limit:     s.Limit,
+		Remaining: s.Remaining,
+		Reset:     s.Reset.String(),
+		TTL:       s.TTL.String(),
+	}
+	if !s.LastRefill.IsZero() {
+		resp.LastRefill = &s.LastRefill
+	}
+
+	return resp
+}
+
+func newLimitsResponse(l ratelimiter.Limits) limitsResponse {
+	return limitsResponse{MaxRequests: l.MaxRequests, UserRequests: l.UserRequests, Interval: l.Interval.String()}
+}
@@ -1,13 +1,26 @@
 package v1
 
 import (
+	"encoding/xml"
+
 	"github.com/gin-gonic/gin"
+
+	"github.com/ransoor2/ip2country/internal/controller/http/format"
 )
 
 type response struct {
-	Error string `json:"error" example:"message"`
+	XMLName xml.Name `json:"-" xml:"response"`
+	Error   string   `json:"error" xml:"error" example:"message"`
+}
+
+func (r response) CSV() [][]string {
+	return [][]string{{"error"}, {r.Error}}
+}
+
+func (r response) Text() string {
+	return r.Error
 }
 
 func errorResponse(c *gin.Context, code int, msg string) {
-	c.AbortWithStatusJSON(code, response{msg})
+	format.Abort(c, code, response{Error: msg})
 }
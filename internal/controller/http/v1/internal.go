@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
+	"github.com/ransoor2/ip2country/pkg/health"
+)
+
+type Readiness interface {
+	Ready(ctx context.Context) health.Report
+}
+
+// NewInternalRouter registers the routes of operators rather than clients:
+// the liveness and readiness probes, the metrics and, when enablePprof is set,
+// the pprof profiles under /debug/pprof, which require the admin policy. They
+// are served by the admin listener when there is one, so that the public port
+// never exposes them.
+func NewInternalRouter(handler *gin.Engine, authenticator middleware.Authenticator, readiness Readiness,
+	policies config.AuthRoutes, enablePprof bool) {
+	// K8s probes. The process is alive as long as it responds, /healthz predates /livez.
+	live := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": health.StatusOK}) }
+	handler.GET("/livez", live)
+	handler.GET("/healthz", live)
+	handler.GET("/readyz", func(c *gin.Context) {
+		report := readiness.Ready(c.Request.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	})
+
+	// Prometheus metrics
+	handler.GET("/metrics",
+		middleware.Authenticate(authenticator, errorResponse),
+		middleware.Authorize(policies.Metrics, errorResponse),
+		gin.WrapH(promhttp.Handler()))
+
+	if !enablePprof {
+		return
+	}
+
+	// Profiles, e.g. curl -H "Authorization: Bearer $ADMIN_TOKEN" localhost:8090/debug/pprof/heap
+	debug := handler.Group("/debug/pprof")
+	debug.Use(middleware.Authenticate(authenticator, errorResponse))
+	debug.Use(middleware.Authorize(policies.Admin, errorResponse))
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	debug.GET("/:profile", func(c *gin.Context) { pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request) })
+}
@@ -2,44 +2,83 @@ package v1
 
 import (
 	"context"
+	"encoding/xml"
 	"net"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/ransoor2/ip2country/internal/controller/http/format"
+	"github.com/ransoor2/ip2country/internal/controller/http/httpcache"
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
+	"github.com/ransoor2/ip2country/internal/entity"
 	"github.com/ransoor2/ip2country/pkg/logger"
 )
 
 type IP2CountryService interface {
 	IP2CountryNCity(context.Context, string) (string, string, error)
+	Location(context.Context, string) (entity.Location, error)
 }
 
 type findCountryResponse struct {
-	Country string `json:"country"`
-	City    string `json:"city"`
+	XMLName xml.Name `json:"-" xml:"location"`
+	Country string   `json:"country" xml:"country"`
+	City    string   `json:"city" xml:"city"`
+	// countryCode is the plain text form, for scripts
+	countryCode string
+}
+
+func (r findCountryResponse) CSV() [][]string {
+	return [][]string{{"country", "city"}, {r.Country, r.City}}
+}
+
+// Text returns the country code, or the country if its code is unknown.
+func (r findCountryResponse) Text() string {
+	if r.countryCode != "" {
+		return r.countryCode
+	}
+
+	return r.Country
 }
 
 type ip2CountryNCityRoutes struct {
 	ip2Country IP2CountryService
+	cache      *httpcache.Policy
 	logger     logger.Interface
 }
 
-func newIPToCountryRoutes(routerGroup *gin.RouterGroup, t IP2CountryService, l logger.Interface) {
-	ip := &ip2CountryNCityRoutes{t, l}
+func newIPToCountryRoutes(routerGroup *gin.RouterGroup, costs middleware.RouteCosts, t IP2CountryService,
+	cache *httpcache.Policy, l logger.Interface) {
+	ip := &ip2CountryNCityRoutes{t, cache, l}
 
-	routerGroup.GET("/find-country", ip.findCountry)
+	costs.Handle(routerGroup, http.MethodGet, "/find-country", middleware.Weight(1), ip.findCountry)
 }
 
 // @Summary     Find Country
 // @Description Find country by IP
 // @ID          find-country
 // @Accept      json
-// @Produce     json
+// @Produce     json,application/xml,text/csv,application/msgpack,plain
 // @Param       ip query string true "IP address"
+// @Param       format query string false "Response format, overriding the Accept header" Enums(json, xml, csv, msgpack, text)
+// @Param       api_key query string false "API key, also accepted in the X-API-Key header"
+// @Param       If-None-Match header string false "ETag of the cached response"
 // @Success     200 {object} findCountryResponse
+// @Header      200 {string} ETag "Version of the response, changing with the dataset"
+// @Header      200 {string} Cache-Control "How long the response can be cached"
+// @Success     304 "Not Modified"
 // @Failure     400 {object} response
+// @Failure     401 {object} response
+// @Failure     403 {object} response
+// @Failure     406 {object} response
 // @Failure     429 {object} response
+// @Header      429 {integer} Retry-After "Seconds to wait before retrying"
+// @Failure     503 {object} response
+// @Header      503 {integer} Retry-After "Seconds to wait before retrying"
 // @Failure     500 {object} response
+// @Header      all {integer} RateLimit-Limit "Maximum number of requests available to the client"
+// @Header      all {integer} RateLimit-Remaining "Number of requests still available to the client"
+// @Header      all {integer} RateLimit-Reset "Seconds until all requests are available again"
 // @Router      /find-country [get]
 func (r *ip2CountryNCityRoutes) findCountry(c *gin.Context) {
 	ip := c.Query("ip")
@@ -55,21 +94,27 @@ func (r *ip2CountryNCityRoutes) findCountry(c *gin.Context) {
 		return
 	}
 
-	country, city, err := r.ip2Country.IP2CountryNCity(c.Request.Context(), ip)
+	if r.cache.NotModified(c, ip) {
+		return
+	}
+
+	location, err := r.ip2Country.Location(c.Request.Context(), ip)
 	if err != nil {
 		r.logger.Error("error finding country", "http - v1 - findCountry", "error", err)
 		errorResponse(c, http.StatusInternalServerError, "error finding country")
 		return
 	}
 
-	if country == "" && city == "" {
+	if !location.Found() {
 		r.logger.Error("country and city not found", "http - v1 - findCountry")
 		errorResponse(c, http.StatusNotFound, "country and city not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, findCountryResponse{
-		Country: country,
-		City:    city,
+	r.cache.Cache(c, ip)
+	format.Render(c, http.StatusOK, findCountryResponse{
+		Country:     location.Country,
+		City:        location.City,
+		countryCode: location.CountryCode,
 	})
 }
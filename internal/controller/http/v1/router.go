@@ -2,23 +2,19 @@
 package v1
 
 import (
-	"context"
-	"net/http"
-
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
+	"github.com/ransoor2/ip2country/config"
 	// Swagger docs.
 	_ "github.com/ransoor2/ip2country/docs"
+	"github.com/ransoor2/ip2country/internal/controller/http/format"
+	"github.com/ransoor2/ip2country/internal/controller/http/httpcache"
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
 	"github.com/ransoor2/ip2country/pkg/logger"
 )
 
-type RateLimiter interface {
-	Allow(ctx context.Context, clientIP string) bool
-}
-
 // NewRouter -.
 // Swagger spec:
 // @title       IP2CountryNCity API
@@ -26,37 +22,32 @@ type RateLimiter interface {
 // @version     1.0
 // @host        localhost:8080
 // @BasePath    /v1
-func NewRouter(handler *gin.Engine, l logger.Interface, ip2CountryService IP2CountryService,
-	rateLimiter RateLimiter) {
+func NewRouter(handler *gin.Engine, l logger.Interface, ip2CountryService IP2CountryService, inFlight *middleware.InFlight,
+	rateLimiter middleware.RateLimiter, keyer middleware.Keyer, authenticator middleware.Authenticator,
+	ipFilter middleware.IPFilter, geoPolicies middleware.GeoPolicies, cache *httpcache.Policy, policies config.AuthRoutes) {
 	// Options
-	handler.Use(gin.Logger())
 	handler.Use(gin.Recovery())
 
-	// Swagger
+	// Swagger, for operators like the metrics
 	swaggerHandler := ginSwagger.DisablingWrapHandler(swaggerFiles.Handler, "DISABLE_SWAGGER_HTTP_HANDLER")
-	handler.GET("/swagger/*any", swaggerHandler)
-
-	// K8s probe
-	handler.GET("/healthz", func(c *gin.Context) { c.Status(http.StatusOK) })
-
-	// Prometheus metrics
-	handler.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	handler.GET("/swagger/*any",
+		middleware.Authenticate(authenticator, errorResponse),
+		middleware.Authorize(policies.Metrics, errorResponse),
+		swaggerHandler)
 
 	// Routers
+	costs := middleware.RouteCosts{}
 	routerGroup := handler.Group("/v1")
-	routerGroup.Use(rateLimiterMiddleware(rateLimiter))
-
-	newIPToCountryRoutes(routerGroup, ip2CountryService, l)
+	routerGroup.Use(format.Negotiate(errorResponse))
+	routerGroup.Use(inFlight.Limit(errorResponse))
+	routerGroup.Use(middleware.FilterIPs(ipFilter, errorResponse))
+	routerGroup.Use(middleware.Authenticate(authenticator, errorResponse))
+	routerGroup.Use(middleware.Authorize(policies.Lookup, errorResponse))
+	if !geoPolicies.Empty() {
+		routerGroup.Use(middleware.ApplyGeoPolicies(ip2CountryService, geoPolicies, errorResponse))
+	}
+	routerGroup.Use(middleware.Limit(rateLimiter, keyer, ipFilter, costs, errorResponse))
 
-}
+	newIPToCountryRoutes(routerGroup, costs, ip2CountryService, cache, l)
 
-func rateLimiterMiddleware(rl RateLimiter) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		if !rl.Allow(c.Request.Context(), clientIP) {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
-			return
-		}
-		c.Next()
-	}
 }
@@ -0,0 +1,79 @@
+package v2
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ransoor2/ip2country/internal/controller/http/format"
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
+)
+
+// Error codes, which tell errors apart regardless of their message.
+const (
+	codeInvalidIP      = "invalid_ip"
+	codeInvalidFields  = "invalid_fields"
+	codeInvalidRequest = "invalid_request"
+	codeUnauthorized   = "unauthorized"
+	codeForbidden      = "forbidden"
+	codeNotFound       = "not_found"
+	codeNotAcceptable  = "not_acceptable"
+	codeRateLimited    = "rate_limited"
+	codeUnavailable    = "unavailable"
+	codeInternal       = "internal"
+)
+
+// response is the envelope of every error of the v2 API.
+type response struct {
+	XMLName xml.Name `json:"-" xml:"response"`
+	Error   apiError `json:"error" xml:"error"`
+}
+
+func (r response) CSV() [][]string {
+	return [][]string{{"code", "message", "request_id"}, {r.Error.Code, r.Error.Message, r.Error.RequestID}}
+}
+
+func (r response) Text() string {
+	return r.Error.Text()
+}
+
+type apiError struct {
+	Code      string `json:"code" xml:"code" example:"invalid_ip"`
+	Message   string `json:"message" xml:"message" example:"invalid IP address format"`
+	RequestID string `json:"request_id,omitempty" xml:"request_id,omitempty" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+}
+
+func (e apiError) Text() string {
+	return e.Code + ": " + e.Message
+}
+
+func errorResponse(c *gin.Context, status int, code, msg string) {
+	format.Abort(c, status, response{Error: apiError{
+		Code:      code,
+		Message:   msg,
+		RequestID: middleware.GetRequestID(c),
+	}})
+}
+
+// abort is the middleware.ErrorFunc of the v2 API, the error code follows
+// from the status of the errors raised by middlewares.
+func abort(c *gin.Context, status int, msg string) {
+	code := codeInternal
+	switch status {
+	case http.StatusBadRequest:
+		code = codeInvalidRequest
+	case http.StatusUnauthorized:
+		code = codeUnauthorized
+	case http.StatusForbidden:
+		code = codeForbidden
+	case http.StatusNotAcceptable:
+		code = codeNotAcceptable
+	case http.StatusTooManyRequests:
+		code = codeRateLimited
+	case http.StatusServiceUnavailable:
+		code = codeUnavailable
+	}
+
+	errorResponse(c, status, code, msg)
+}
@@ -0,0 +1,382 @@
+package v2
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/ransoor2/ip2country/internal/controller/http/format"
+	"github.com/ransoor2/ip2country/internal/controller/http/httpcache"
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
+	"github.com/ransoor2/ip2country/internal/entity"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+// maxBatchSize is the maximum number of addresses of a batch lookup.
+const maxBatchSize = 1000
+
+// maxBatchBytes bounds the body of batch lookups, leaving room for maxBatchSize
+// IPv6 addresses along with whitespace.
+const maxBatchBytes = 64 << 10
+
+type IP2CountryService interface {
+	IP2CountryNCity(context.Context, string) (string, string, error)
+	Location(context.Context, string) (entity.Location, error)
+}
+
+// locationFields are the fields of location records, in the order they are rendered.
+var locationFields = []string{"ip", "country", "country_code", "region", "city", "latitude", "longitude", "time_zone"}
+
+// locationResponse is a location record, limited to the selected fields.
+// Fields unknown for the address are empty.
+type locationResponse struct {
+	IP          *string  `json:"ip,omitempty" xml:"ip,omitempty" example:"8.8.8.8"`
+	Country     *string  `json:"country,omitempty" xml:"country,omitempty" example:"United States"`
+	CountryCode *string  `json:"country_code,omitempty" xml:"country_code,omitempty" example:"US"`
+	Region      *string  `json:"region,omitempty" xml:"region,omitempty" example:"California"`
+	City        *string  `json:"city,omitempty" xml:"city,omitempty" example:"Mountain View"`
+	Latitude    *float64 `json:"latitude,omitempty" xml:"latitude,omitempty" example:"37.386"`
+	Longitude   *float64 `json:"longitude,omitempty" xml:"longitude,omitempty" example:"-122.0838"`
+	TimeZone    *string  `json:"time_zone,omitempty" xml:"time_zone,omitempty" example:"America/Los_Angeles"`
+	// selected tells selections apart from full records in plain text
+	selected bool
+}
+
+// newLocationResponse returns the fields of l, all of them if none is selected.
+func newLocationResponse(l entity.Location, fields []string) *locationResponse {
+	r := &locationResponse{selected: len(fields) > 0}
+	if !r.selected {
+		fields = locationFields
+	}
+
+	for _, field := range fields {
+		switch field {
+		case "ip":
+			r.IP = &l.IP
+		case "country":
+			r.Country = &l.Country
+		case "country_code":
+			r.CountryCode = &l.CountryCode
+		case "region":
+			r.Region = &l.Region
+		case "city":
+			r.City = &l.City
+		case "latitude":
+			r.Latitude = &l.Latitude
+		case "longitude":
+			r.Longitude = &l.Longitude
+		case "time_zone":
+			r.TimeZone = &l.TimeZone
+		}
+	}
+
+	return r
+}
+
+// columns returns the names and values of the fields of the record.
+func (r *locationResponse) columns() (names, values []string) {
+	for _, col := range []struct {
+		name  string
+		set   bool
+		value func() string
+	}{
+		{"ip", r.IP != nil, func() string { return *r.IP }},
+		{"country", r.Country != nil, func() string { return *r.Country }},
+		{"country_code", r.CountryCode != nil, func() string { return *r.CountryCode }},
+		{"region", r.Region != nil, func() string { return *r.Region }},
+		{"city", r.City != nil, func() string { return *r.City }},
+		{"latitude", r.Latitude != nil, func() string { return strconv.FormatFloat(*r.Latitude, 'f', -1, 64) }},
+		{"longitude", r.Longitude != nil, func() string { return strconv.FormatFloat(*r.Longitude, 'f', -1, 64) }},
+		{"time_zone", r.TimeZone != nil, func() string { return *r.TimeZone }},
+	} {
+		if col.set {
+			names = append(names, col.name)
+			values = append(values, col.value())
+		}
+	}
+
+	return names, values
+}
+
+// Text returns the country code of full records, or the country if its code
+// is unknown, and the tab separated values of selections.
+func (r *locationResponse) Text() string {
+	if !r.selected {
+		if *r.CountryCode != "" {
+			return *r.CountryCode
+		}
+		return *r.Country
+	}
+
+	_, values := r.columns()
+
+	return strings.Join(values, "\t")
+}
+
+// dataResponse is the envelope of every successful response of the v2 API.
+type dataResponse struct {
+	XMLName xml.Name          `json:"-" xml:"response"`
+	Data    *locationResponse `json:"data" xml:"data"`
+}
+
+func (r dataResponse) CSV() [][]string {
+	names, values := r.Data.columns()
+
+	return [][]string{names, values}
+}
+
+func (r dataResponse) Text() string {
+	return r.Data.Text()
+}
+
+type batchRequest struct {
+	IPs []string `json:"ips" example:"8.8.8.8,1.1.1.1"`
+}
+
+// batchResult is the location of an address of a batch, or why it failed.
+type batchResult struct {
+	IP    string            `json:"ip" xml:"ip" example:"8.8.8.8"`
+	Data  *locationResponse `json:"data,omitempty" xml:"data,omitempty"`
+	Error *apiError         `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+type batchResponse struct {
+	XMLName xml.Name      `json:"-" xml:"response"`
+	Data    []batchResult `json:"data" xml:"result"`
+	// fields are the selected fields, the columns of the CSV form
+	fields []string
+}
+
+// CSV returns a row per address, with the selected fields of its location or
+// the code of its error.
+func (r batchResponse) CSV() [][]string {
+	fields := r.fields
+	if len(fields) == 0 {
+		fields = locationFields
+	}
+
+	rows := [][]string{append(append([]string{"ip"}, fields...), "error")}
+	for _, result := range r.Data {
+		row := make([]string, 0, len(fields)+2)
+		row = append(row, result.IP)
+		if result.Error != nil {
+			row = append(row, make([]string, len(fields))...)
+			rows = append(rows, append(row, result.Error.Code))
+			continue
+		}
+		_, values := result.Data.columns()
+		rows = append(rows, append(append(row, values...), ""))
+	}
+
+	return rows
+}
+
+// Text returns a line per address, with its text form or its error.
+func (r batchResponse) Text() string {
+	lines := make([]string, 0, len(r.Data))
+	for _, result := range r.Data {
+		text := ""
+		if result.Error != nil {
+			text = result.Error.Text()
+		} else {
+			text = result.Data.Text()
+		}
+		lines = append(lines, result.IP+"\t"+text)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+type ipRoutes struct {
+	ip2Country IP2CountryService
+	cache      *httpcache.Policy
+	logger     logger.Interface
+}
+
+func newIPRoutes(routerGroup *gin.RouterGroup, costs middleware.RouteCosts, t IP2CountryService,
+	cache *httpcache.Policy, l logger.Interface) {
+	r := &ipRoutes{t, cache, l}
+
+	costs.Handle(routerGroup, http.MethodGet, "/ip/:ip", middleware.Weight(1), r.location)
+	costs.Handle(routerGroup, http.MethodPost, "/ip/batch", batchCost, r.batch)
+}
+
+// batchCost charges batches a request per address. Invalid batches, which
+// the handler rejects, cost a single request so that they get 400 rather than 429.
+func batchCost(c *gin.Context) int {
+	var req batchRequest
+	if err := bindBatch(c, &req); err != nil || len(req.IPs) > maxBatchSize {
+		return 1
+	}
+
+	return max(len(req.IPs), 1)
+}
+
+// bindBatch reads the body of a batch lookup once, up to maxBatchBytes, for
+// both the cost of the request and its handler.
+func bindBatch(c *gin.Context, req *batchRequest) error {
+	if _, ok := c.Get(gin.BodyBytesKey); !ok {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchBytes)
+	}
+
+	return c.ShouldBindBodyWith(req, binding.JSON)
+}
+
+// @Summary     Locate IP
+// @Description Location record of an IP address, optionally limited to some of its fields
+// @ID          ip-location
+// @Produce     json,application/xml,text/csv,application/msgpack,plain
+// @Param       ip path string true "IP address"
+// @Param       fields query string false "Comma separated fields to return, e.g. country_code,city"
+// @Param       format query string false "Response format, overriding the Accept header" Enums(json, xml, csv, msgpack, text)
+// @Param       api_key query string false "API key, also accepted in the X-API-Key header"
+// @Param       X-Request-ID header string false "Request ID, echoed in the response and errors"
+// @Param       If-None-Match header string false "ETag of the cached response"
+// @Success     200 {object} dataResponse{data=locationResponse}
+// @Header      200 {string} ETag "Version of the response, changing with the dataset"
+// @Header      200 {string} Cache-Control "How long the response can be cached"
+// @Success     304 "Not Modified"
+// @Failure     400 {object} response
+// @Failure     401 {object} response
+// @Failure     403 {object} response
+// @Failure     404 {object} response
+// @Failure     406 {object} response
+// @Failure     429 {object} response
+// @Header      429 {integer} Retry-After "Seconds to wait before retrying"
+// @Failure     503 {object} response
+// @Header      503 {integer} Retry-After "Seconds to wait before retrying"
+// @Failure     500 {object} response
+// @Header      all {string} X-Request-ID "Request ID"
+// @Header      all {integer} RateLimit-Limit "Maximum number of requests available to the client"
+// @Header      all {integer} RateLimit-Remaining "Number of requests still available to the client"
+// @Header      all {integer} RateLimit-Reset "Seconds until all requests are available again"
+// @Router      /ip/{ip} [get]
+func (r *ipRoutes) location(c *gin.Context) {
+	fields, err := parseFields(c.Query("fields"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, codeInvalidFields, err.Error())
+		return
+	}
+
+	ip, selection := c.Param("ip"), strings.Join(fields, ",")
+	if net.ParseIP(ip) != nil && r.cache.NotModified(c, ip, selection) {
+		return
+	}
+
+	location, apiErr := r.lookup(c.Request.Context(), ip)
+	if apiErr != nil {
+		errorResponse(c, apiErr.status, apiErr.Code, apiErr.Message)
+		return
+	}
+
+	r.cache.Cache(c, ip, selection)
+	format.Render(c, http.StatusOK, dataResponse{Data: newLocationResponse(location, fields)})
+}
+
+// @Summary     Locate IPs
+// @Description Location records of up to 1000 IP addresses, costing a request per address. Failed lookups are reported per result.
+// @ID          ip-location-batch
+// @Accept      json
+// @Produce     json,application/xml,text/csv,application/msgpack,plain
+// @Param       request body batchRequest true "IP addresses"
+// @Param       fields query string false "Comma separated fields to return, e.g. country_code,city"
+// @Param       format query string false "Response format, overriding the Accept header" Enums(json, xml, csv, msgpack, text)
+// @Param       api_key query string false "API key, also accepted in the X-API-Key header"
+// @Param       X-Request-ID header string false "Request ID, echoed in the response and errors"
+// @Success     200 {object} batchResponse
+// @Failure     400 {object} response
+// @Failure     401 {object} response
+// @Failure     403 {object} response
+// @Failure     406 {object} response
+// @Failure     429 {object} response
+// @Header      429 {integer} Retry-After "Seconds to wait before retrying"
+// @Failure     503 {object} response
+// @Header      503 {integer} Retry-After "Seconds to wait before retrying"
+// @Header      all {string} X-Request-ID "Request ID"
+// @Header      all {integer} RateLimit-Limit "Maximum number of requests available to the client"
+// @Header      all {integer} RateLimit-Remaining "Number of requests still available to the client"
+// @Header      all {integer} RateLimit-Reset "Seconds until all requests are available again"
+// @Router      /ip/batch [post]
+func (r *ipRoutes) batch(c *gin.Context) {
+	fields, err := parseFields(c.Query("fields"))
+	if err != nil {
+		errorResponse(c, http.StatusBadRequest, codeInvalidFields, err.Error())
+		return
+	}
+
+	var req batchRequest
+	if err := bindBatch(c, &req); err != nil {
+		errorResponse(c, http.StatusBadRequest, codeInvalidRequest, "invalid request body")
+		return
+	}
+	if len(req.IPs) == 0 || len(req.IPs) > maxBatchSize {
+		errorResponse(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("ips must hold 1 to %d IP addresses", maxBatchSize))
+		return
+	}
+
+	resp := batchResponse{Data: make([]batchResult, 0, len(req.IPs)), fields: fields}
+	for _, ip := range req.IPs {
+		result := batchResult{IP: ip}
+		location, apiErr := r.lookup(c.Request.Context(), ip)
+		if apiErr != nil {
+			result.Error = &apiErr.apiError
+		} else {
+			result.Data = newLocationResponse(location, fields)
+		}
+		resp.Data = append(resp.Data, result)
+	}
+
+	format.Render(c, http.StatusOK, resp)
+}
+
+// lookupError is a failed lookup and the status it is reported with.
+type lookupError struct {
+	apiError
+	status int
+}
+
+// lookup returns the location of ip, or why it can't be located.
+func (r *ipRoutes) lookup(ctx context.Context, ip string) (entity.Location, *lookupError) {
+	if net.ParseIP(ip) == nil {
+		return entity.Location{}, &lookupError{apiError{Code: codeInvalidIP, Message: "invalid IP address format"}, http.StatusBadRequest}
+	}
+
+	location, err := r.ip2Country.Location(ctx, ip)
+	if err != nil {
+		r.logger.Error("error finding location", "http - v2 - lookup", "error", err)
+		return entity.Location{}, &lookupError{apiError{Code: codeInternal, Message: "error finding location"}, http.StatusInternalServerError}
+	}
+
+	if !location.Found() {
+		return entity.Location{}, &lookupError{apiError{Code: codeNotFound, Message: "location not found"}, http.StatusNotFound}
+	}
+
+	return location, nil
+}
+
+// parseFields returns the fields selected by the comma separated list, none
+// if it is empty.
+func parseFields(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(locationFields, field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,61 @@
+// Package v2 implements routing paths of the v2 API. Each services in own file.
+package v2
+
+import (
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+
+	"github.com/ransoor2/ip2country/config"
+	// Swagger docs.
+	_ "github.com/ransoor2/ip2country/docs/v2"
+	"github.com/ransoor2/ip2country/internal/controller/http/format"
+	"github.com/ransoor2/ip2country/internal/controller/http/httpcache"
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+// swaggerInstance is the name of the v2 swagger docs, next to the v1 ones.
+const swaggerInstance = "v2"
+
+// NewRouter registers the v2 API under /v2, behind the same IP filter,
+// authentication, geo policies and rate limits as v1. The routes of operators
+// (probes, metrics) are registered by v1.NewInternalRouter.
+// Swagger spec:
+// @title       IP2Country API
+// @description Locating IP addresses
+// @version     2.0
+// @host        localhost:8080
+// @BasePath    /v2
+func NewRouter(handler *gin.Engine, l logger.Interface, ip2CountryService IP2CountryService, inFlight *middleware.InFlight,
+	rateLimiter middleware.RateLimiter, keyer middleware.Keyer, authenticator middleware.Authenticator,
+	ipFilter middleware.IPFilter, geoPolicies middleware.GeoPolicies, cache *httpcache.Policy, policies config.AuthRoutes) {
+	// Swagger, for operators like the metrics
+	swaggerHandler := ginSwagger.DisablingCustomWrapHandler(&ginSwagger.Config{
+		URL:                      "doc.json",
+		DocExpansion:             "list",
+		InstanceName:             swaggerInstance,
+		DefaultModelsExpandDepth: 1,
+		DeepLinking:              true,
+	}, swaggerFiles.Handler, "DISABLE_SWAGGER_HTTP_HANDLER")
+	handler.GET("/v2/swagger/*any",
+		middleware.Authenticate(authenticator, abort),
+		middleware.Authorize(policies.Metrics, abort),
+		swaggerHandler)
+
+	// Routers
+	costs := middleware.RouteCosts{}
+	routerGroup := handler.Group("/v2")
+	routerGroup.Use(middleware.RequestID())
+	routerGroup.Use(format.Negotiate(abort))
+	routerGroup.Use(inFlight.Limit(abort))
+	routerGroup.Use(middleware.FilterIPs(ipFilter, abort))
+	routerGroup.Use(middleware.Authenticate(authenticator, abort))
+	routerGroup.Use(middleware.Authorize(policies.Lookup, abort))
+	if !geoPolicies.Empty() {
+		routerGroup.Use(middleware.ApplyGeoPolicies(ip2CountryService, geoPolicies, abort))
+	}
+	routerGroup.Use(middleware.Limit(rateLimiter, keyer, ipFilter, costs, abort))
+
+	newIPRoutes(routerGroup, costs, ip2CountryService, cache, l)
+}
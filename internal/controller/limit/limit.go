@@ -0,0 +1,71 @@
+// Package limit builds the rate limited requests of API calls, the same way
+// for the HTTP and gRPC APIs.
+package limit
+
+import (
+	"net/http"
+
+	"github.com/ransoor2/ip2country/internal/apikey"
+	"github.com/ransoor2/ip2country/internal/auth"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+type Keyer interface {
+	Keys(c ratelimiter.Client) []ratelimiter.KeyLimit
+}
+
+// Client is the caller of an API, as far as its rate limits are concerned.
+type Client struct {
+	IP     string
+	Header http.Header
+	// Principal is the authenticated principal, nil for anonymous calls.
+	Principal *auth.Principal
+	// Allowlisted marks calls from allowed networks.
+	Allowlisted bool
+	// GeoLimit is the limit a geo policy sets for the client's country, if any.
+	GeoLimit *ratelimiter.Limit
+}
+
+// Request returns the rate limited request of c, or false if c bypasses the
+// rate limiter. Calls are limited by API key, or by the keys of keyer
+// (principal, or client IP for anonymous calls, by default) for calls without
+// one; the keys applying to API key calls are limited on top of their tier.
+// Calls from allowed networks bypass the rate limiter, or get allowLimit per
+// IP when it is set, and calls matched by a geo policy get the policy's limit
+// for their first key. The cost of the request is left to the caller.
+func Request(c Client, keyer Keyer, allowLimit *ratelimiter.Limit) (ratelimiter.Request, bool) {
+	var key *apikey.Key
+	client := ratelimiter.Client{IP: c.IP, Header: c.Header}
+	switch p := c.Principal; {
+	case p == nil:
+	case p.Key != nil:
+		key = p.Key
+		client.APIKey = key.Name
+	default:
+		client.Principal = p.ID()
+	}
+	keys := keyer.Keys(client)
+
+	req := ratelimiter.Request{Key: c.IP}
+	if len(keys) > 0 {
+		req = ratelimiter.Request{Key: keys[0].Key, Keys: keys[1:]}
+		// Keys without a limit of their own get the limiter's per client limit
+		if keys[0].Limit != (ratelimiter.Limit{}) {
+			req.Limit = &keys[0].Limit
+		}
+	}
+	if c.Allowlisted {
+		if allowLimit == nil {
+			return ratelimiter.Request{}, false
+		}
+		req = ratelimiter.Request{Key: c.IP, Limit: allowLimit}
+	}
+	if c.GeoLimit != nil {
+		req.Limit = c.GeoLimit
+	}
+	if key != nil {
+		req = ratelimiter.Request{Key: "key:" + key.Name, Limit: &key.Tier.Limit, Keys: keys, Quotas: key.Tier.Quotas}
+	}
+
+	return req, true
+}
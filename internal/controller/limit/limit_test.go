@@ -0,0 +1,91 @@
+package limit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/internal/apikey"
+	"github.com/ransoor2/ip2country/internal/auth"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+// keyer keys clients by principal, or IP for anonymous ones, plus their /24.
+type keyer struct{}
+
+func (keyer) Keys(c ratelimiter.Client) []ratelimiter.KeyLimit {
+	key := c.IP
+	switch {
+	case c.APIKey != "":
+		key = "key:" + c.APIKey
+	case c.Principal != "":
+		key = c.Principal
+	}
+
+	return []ratelimiter.KeyLimit{{Key: key}, {Key: "net:" + c.IP + "/24", Limit: ratelimiter.Limit{Requests: 50, Interval: time.Minute}}}
+}
+
+func TestRequest(t *testing.T) {
+	allowLimit := &ratelimiter.Limit{Requests: 1000, Interval: time.Minute}
+	geoLimit := &ratelimiter.Limit{Requests: 1, Interval: time.Minute}
+	key := &apikey.Key{Name: "acme", Tier: apikey.Tier{Limit: ratelimiter.Limit{Requests: 100, Interval: time.Minute}}}
+	netKeys := []ratelimiter.KeyLimit{{Key: "net:10.0.0.1/24", Limit: ratelimiter.Limit{Requests: 50, Interval: time.Minute}}}
+
+	tests := []struct {
+		name       string
+		client     Client
+		allowLimit *ratelimiter.Limit
+		want       ratelimiter.Request
+		limited    bool
+	}{
+		{
+			name:    "anonymous",
+			client:  Client{IP: "10.0.0.1"},
+			want:    ratelimiter.Request{Key: "10.0.0.1", Keys: netKeys},
+			limited: true,
+		},
+		{
+			name:    "principal",
+			client:  Client{IP: "10.0.0.1", Principal: &auth.Principal{Name: "alice", Method: auth.MethodJWT}},
+			want:    ratelimiter.Request{Key: "jwt:alice", Keys: netKeys},
+			limited: true,
+		},
+		{
+			name:   "API key",
+			client: Client{IP: "10.0.0.1", Principal: &auth.Principal{Name: "acme", Method: auth.MethodAPIKey, Key: key}},
+			// The keys of the client are limited on top of the tier
+			want: ratelimiter.Request{
+				Key:   "key:acme",
+				Limit: &key.Tier.Limit,
+				Keys:  append([]ratelimiter.KeyLimit{{Key: "key:acme"}}, netKeys...),
+			},
+			limited: true,
+		},
+		{
+			name:    "geo policy",
+			client:  Client{IP: "10.0.0.1", GeoLimit: geoLimit},
+			want:    ratelimiter.Request{Key: "10.0.0.1", Limit: geoLimit, Keys: netKeys},
+			limited: true,
+		},
+		{
+			name:   "allowed network",
+			client: Client{IP: "10.0.0.1", Allowlisted: true},
+		},
+		{
+			name:       "allowed network with a limit",
+			client:     Client{IP: "10.0.0.1", Allowlisted: true},
+			allowLimit: allowLimit,
+			want:       ratelimiter.Request{Key: "10.0.0.1", Limit: allowLimit},
+			limited:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, limited := Request(tc.client, keyer{}, tc.allowLimit)
+			assert.Equal(t, tc.limited, limited)
+			assert.Equal(t, tc.want, req)
+		})
+	}
+}
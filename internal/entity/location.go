@@ -0,0 +1,21 @@
+// Package entity defines the domain entities.
+package entity
+
+// Location is the location of an IP address. Records only need an IP, a
+// country and a city, the other fields are left empty when unknown.
+type Location struct {
+	IP          string  `json:"ip" bson:"ip"`
+	Country     string  `json:"country" bson:"country"`
+	CountryCode string  `json:"country_code,omitempty" bson:"country_code"`
+	Region      string  `json:"region,omitempty" bson:"region"`
+	City        string  `json:"city" bson:"city"`
+	Latitude    float64 `json:"latitude,omitempty" bson:"latitude"`
+	Longitude   float64 `json:"longitude,omitempty" bson:"longitude"`
+	TimeZone    string  `json:"time_zone,omitempty" bson:"time_zone"`
+}
+
+// Found reports whether the location is known, repositories return an empty
+// location for unknown IP addresses.
+func (l Location) Found() bool {
+	return l.Country != "" || l.City != ""
+}
@@ -0,0 +1,102 @@
+// Package geopolicy resolves the rate limiting policy of a client's country.
+package geopolicy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+// Action is what a policy does with the requests it matches.
+type Action string
+
+const (
+	// Limit rate limits requests with the policy's limit.
+	Limit Action = "limit"
+	// Block rejects requests.
+	Block Action = "block"
+)
+
+// anyCountry matches the countries no other policy lists.
+const anyCountry = "*"
+
+var matches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "geo_policy_matches_total",
+	Help: "Number of requests matched by each geo policy.",
+}, []string{"policy", "action"})
+
+// Policy applies to the clients of a set of countries.
+type Policy struct {
+	Name   string
+	Action Action
+	// Limit replaces the per client limit, nil for blocking policies.
+	Limit *ratelimiter.Limit
+}
+
+// Policies holds the configured policies, indexed by country.
+type Policies struct {
+	byCountry map[string]*Policy
+	fallback  *Policy
+}
+
+func New(cfg config.GeoPolicies) (*Policies, error) {
+	p := &Policies{byCountry: make(map[string]*Policy)}
+
+	for _, pc := range cfg.Policies {
+		policy := &Policy{Name: pc.Name, Action: Action(pc.Action)}
+		if policy.Action == Limit {
+			policy.Limit = &ratelimiter.Limit{
+				Requests: pc.Requests,
+				Burst:    pc.Burst,
+				Interval: pc.Interval,
+			}
+		}
+
+		for _, country := range pc.Countries {
+			if country == anyCountry {
+				if p.fallback != nil {
+					return nil, fmt.Errorf("geopolicy - New - policy %q: %q already used by policy %q", pc.Name, anyCountry, p.fallback.Name)
+				}
+				p.fallback = policy
+				continue
+			}
+
+			country = normalize(country)
+			if other, exists := p.byCountry[country]; exists {
+				return nil, fmt.Errorf("geopolicy - New - policy %q: country %q already used by policy %q", pc.Name, country, other.Name)
+			}
+			p.byCountry[country] = policy
+		}
+	}
+
+	return p, nil
+}
+
+// Empty reports whether there are no policies, in which case countries need not be resolved.
+func (p *Policies) Empty() bool {
+	return len(p.byCountry) == 0 && p.fallback == nil
+}
+
+// Match returns the policy of country, nil if there is none.
+func (p *Policies) Match(country string) *Policy {
+	policy, ok := p.byCountry[normalize(country)]
+	if !ok {
+		policy = p.fallback
+	}
+
+	if policy != nil {
+		matches.WithLabelValues(policy.Name, string(policy.Action)).Inc()
+	}
+
+	return policy
+}
+
+// normalize makes country names match regardless of case and surrounding spaces.
+func normalize(country string) string {
+	return strings.ToLower(strings.TrimSpace(country))
+}
@@ -0,0 +1,56 @@
+package geopolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+func TestMatch(t *testing.T) {
+	policies, err := New(config.GeoPolicies{Policies: []config.GeoPolicy{
+		{Name: "oceania", Countries: []string{"Australia", "New Zealand"}, Action: "limit", Requests: 20, Interval: time.Second},
+		{Name: "embargo", Countries: []string{"Sample Country"}, Action: "block"},
+	}})
+	assert.NoError(t, err)
+	assert.False(t, policies.Empty())
+
+	policy := policies.Match("australia")
+	assert.Equal(t, "oceania", policy.Name)
+	assert.Equal(t, Limit, policy.Action)
+	assert.Equal(t, &ratelimiter.Limit{Requests: 20, Interval: time.Second}, policy.Limit)
+
+	policy = policies.Match("Sample Country")
+	assert.Equal(t, Block, policy.Action)
+	assert.Nil(t, policy.Limit)
+
+	assert.Nil(t, policies.Match("United States"))
+	assert.Nil(t, policies.Match(""))
+}
+
+func TestMatchAnyCountry(t *testing.T) {
+	policies, err := New(config.GeoPolicies{Policies: []config.GeoPolicy{
+		{Name: "home", Countries: []string{"Israel"}, Action: "limit", Requests: 50, Interval: time.Second},
+		{Name: "abroad", Countries: []string{"*"}, Action: "limit", Requests: 2, Interval: time.Second},
+	}})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "home", policies.Match("Israel").Name)
+	assert.Equal(t, "abroad", policies.Match("United States").Name)
+	assert.Equal(t, "abroad", policies.Match("").Name, "clients of unknown countries fall back too")
+}
+
+func TestNewDuplicateCountry(t *testing.T) {
+	_, err := New(config.GeoPolicies{Policies: []config.GeoPolicy{
+		{Name: "a", Countries: []string{"Australia"}, Action: "block"},
+		{Name: "b", Countries: []string{" AUSTRALIA "}, Action: "block"},
+	}})
+	assert.Error(t, err)
+
+	policies, err := New(config.GeoPolicies{})
+	assert.NoError(t, err)
+	assert.True(t, policies.Empty())
+}
@@ -2,13 +2,20 @@ package ip2country
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"time"
 
+	"github.com/ransoor2/ip2country/internal/entity"
 	"github.com/ransoor2/ip2country/pkg/logger"
 )
 
 type Repository interface {
-	CountryNCityByIP(context.Context, string) (string, string, error)
+	LocationByIP(context.Context, string) (entity.Location, error)
+	// Version identifies the dataset, empty if it can't tell
+	Version() string
+	// Ping checks that the dataset can be queried
+	Ping(context.Context) error
 }
 
 type Cache interface {
@@ -17,9 +24,10 @@ type Cache interface {
 }
 
 type IP2Country struct {
-	repo   Repository
-	logger logger.Interface
-	cache  Cache
+	repo     Repository
+	logger   logger.Interface
+	cache    Cache
+	warmedUp atomic.Bool
 }
 
 func New(repo Repository, l logger.Interface, cache Cache) *IP2Country {
@@ -31,22 +39,64 @@ func New(repo Repository, l logger.Interface, cache Cache) *IP2Country {
 }
 
 func (c *IP2Country) IP2CountryNCity(ctx context.Context, ip string) (country, city string, err error) {
+	location, err := c.Location(ctx, ip)
+	if err != nil {
+		return "", "", err
+	}
+
+	return location.Country, location.City, nil
+}
+
+// Location returns the location record of ip, which is empty if ip is unknown.
+func (c *IP2Country) Location(ctx context.Context, ip string) (entity.Location, error) {
 	// Check cache first
 	if cachedValue, found := c.cache.Get(ip); found {
-		if result, ok := cachedValue.([2]string); ok {
-			return result[0], result[1], nil
+		if result, ok := cachedValue.(entity.Location); ok {
+			return result, nil
 		}
 	}
 
 	// Fetch from repository if not in cache
-	country, city, err = c.repo.CountryNCityByIP(ctx, ip)
+	location, err := c.repo.LocationByIP(ctx, ip)
 	if err != nil {
-		c.logger.Error("error finding country", "http - v1 - findCountry", "error", err)
-		return "", "", err
+		c.logger.Error("error finding location", "ip2country - Location", "error", err)
+		return entity.Location{}, err
 	}
 
 	// Store result in cache
-	c.cache.Set(ip, [2]string{country, city}, 10*time.Minute)
+	c.cache.Set(ip, location, 10*time.Minute)
+
+	return location, nil
+}
+
+// DatasetVersion returns the version of the dataset, empty if it is unknown.
+func (c *IP2Country) DatasetVersion() string {
+	return c.repo.Version()
+}
+
+// Ping checks that the dataset can be queried.
+func (c *IP2Country) Ping(ctx context.Context) error {
+	return c.repo.Ping(ctx)
+}
+
+// WarmUp caches the locations of ips, e.g. of the busiest clients, so that
+// the first requests after startup don't all hit the repository. Failed
+// lookups are logged and skipped.
+func (c *IP2Country) WarmUp(ctx context.Context, ips []string) {
+	for _, ip := range ips {
+		if ctx.Err() != nil {
+			return
+		}
+		_, _ = c.Location(ctx, ip)
+	}
+	c.warmedUp.Store(true)
+}
+
+// WarmedUp returns an error until WarmUp is done.
+func (c *IP2Country) WarmedUp(_ context.Context) error {
+	if !c.warmedUp.Load() {
+		return errors.New("the cache is warming up")
+	}
 
-	return country, city, nil
+	return nil
 }
@@ -2,25 +2,27 @@ package disk
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+
+	"github.com/ransoor2/ip2country/internal/entity"
 )
 
 type Repository struct {
-	data map[string]CountryCity
-}
-
-type CountryCity struct {
-	IP      string `json:"ip"`
-	City    string `json:"city"`
-	Country string `json:"country"`
+	data map[string]entity.Location
+	// version is the hash of the data files
+	version string
 }
 
 func New(path string) (Repository, error) {
 	repo := Repository{
-		data: make(map[string]CountryCity),
+		data: make(map[string]entity.Location),
 	}
+	hash := sha256.New()
 
 	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -31,14 +33,15 @@ func New(path string) (Repository, error) {
 			if err != nil {
 				return err
 			}
+			hash.Write(fileData)
 
-			var countryCities []CountryCity
-			if err := json.Unmarshal(fileData, &countryCities); err != nil {
+			var locations []entity.Location
+			if err := json.Unmarshal(fileData, &locations); err != nil {
 				return err
 			}
 
-			for _, countryCity := range countryCities {
-				repo.data[countryCity.IP] = countryCity
+			for _, location := range locations {
+				repo.data[location.IP] = location
 			}
 		}
 		return nil
@@ -47,13 +50,25 @@ func New(path string) (Repository, error) {
 	if err != nil {
 		return Repository{}, err
 	}
+	repo.version = hex.EncodeToString(hash.Sum(nil))
 
 	return repo, nil
 }
 
-func (r Repository) CountryNCityByIP(_ context.Context, ip string) (country, city string, err error) {
-	if countryCity, exists := r.data[ip]; exists {
-		return countryCity.Country, countryCity.City, nil
+func (r Repository) LocationByIP(_ context.Context, ip string) (entity.Location, error) {
+	return r.data[ip], nil
+}
+
+// Ping checks that the dataset is not empty, e.g. because of a wrong path.
+func (r Repository) Ping(_ context.Context) error {
+	if len(r.data) == 0 {
+		return errors.New("the dataset is empty")
 	}
-	return "", "", nil
+
+	return nil
+}
+
+// Version returns the hash of the data files, which changes along with them.
+func (r Repository) Version() string {
+	return r.version
 }
@@ -1,6 +1,7 @@
 package disk
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -57,3 +58,56 @@ func TestNew(t *testing.T) {
 		}
 	}
 }
+
+func TestVersion(t *testing.T) {
+	tempDir := t.TempDir()
+	sampleFilePath := filepath.Join(tempDir, "data.json")
+
+	versions := map[string]bool{}
+	for _, data := range []string{
+		`[{"ip": "8.8.8.8", "city": "Mountain View", "country": "United States"}]`,
+		`[{"ip": "8.8.8.8", "city": "Mountain View", "country": "United States", "country_code": "US"}]`,
+	} {
+		if err := os.WriteFile(sampleFilePath, []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write sample JSON file: %v", err)
+		}
+
+		repo, err := New(tempDir)
+		if err != nil {
+			t.Fatalf("Failed to initialize repository: %v", err)
+		}
+		if repo.Version() == "" {
+			t.Errorf("Expected a version")
+		}
+		versions[repo.Version()] = true
+	}
+
+	if len(versions) != 2 {
+		t.Errorf("Expected the version to change along with the data")
+	}
+}
+
+func TestPing(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// No data files, e.g. a wrong path
+	repo, err := New(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+	if repo.Ping(context.Background()) == nil {
+		t.Errorf("Expected an empty dataset to fail the ping")
+	}
+
+	data := `[{"ip": "8.8.8.8", "city": "Mountain View", "country": "United States"}]`
+	if err := os.WriteFile(filepath.Join(tempDir, "data.json"), []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write sample JSON file: %v", err)
+	}
+	repo, err = New(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to initialize repository: %v", err)
+	}
+	if err := repo.Ping(context.Background()); err != nil {
+		t.Errorf("Unexpected ping error: %v", err)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/ransoor2/ip2country/internal/entity"
 )
 
 type Repository struct {
@@ -26,20 +28,41 @@ func New(uri, dbName, collectionName string) (Repository, error) {
 	return Repository{client: client, collection: collection}, nil
 }
 
-func (r Repository) CountryNCityByIP(ctx context.Context, ip string) (country, city string, err error) {
-	var result struct {
-		Country string `bson:"country"`
-		City    string `bson:"city"`
-	}
+func (r Repository) LocationByIP(ctx context.Context, ip string) (entity.Location, error) {
+	var result entity.Location
 
 	filter := bson.M{"ip": ip}
-	err = r.collection.FindOne(ctx, filter).Decode(&result)
+	err := r.collection.FindOne(ctx, filter).Decode(&result)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return "", "", fmt.Errorf("no document found for IP: %s", ip)
+			return entity.Location{}, fmt.Errorf("no document found for IP: %s", ip)
 		}
-		return "", "", fmt.Errorf("failed to find document: %w", err)
+		return entity.Location{}, fmt.Errorf("failed to find document: %w", err)
+	}
+
+	return result, nil
+}
+
+// Ping checks that MongoDB is reachable.
+func (r Repository) Ping(ctx context.Context) error {
+	if err := r.client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	return result.Country, result.City, nil
+	return nil
+}
+
+// Close disconnects from MongoDB, waiting for the operations in progress within ctx.
+func (r Repository) Close(ctx context.Context) error {
+	if err := r.client.Disconnect(ctx); err != nil {
+		return fmt.Errorf("failed to disconnect from MongoDB: %w", err)
+	}
+
+	return nil
+}
+
+// Version returns an empty version, the collection can change at any time
+// without the repository noticing.
+func (r Repository) Version() string {
+	return ""
 }
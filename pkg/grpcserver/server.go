@@ -0,0 +1,88 @@
+// Package grpcserver implements gRPC server.
+package grpcserver
+
+import (
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	_defaultAddr            = ":81"
+	_defaultShutdownTimeout = 3 * time.Second
+)
+
+// Server -.
+type Server struct {
+	server          *grpc.Server
+	addr            string
+	lis             net.Listener
+	notify          chan error
+	shutdownTimeout time.Duration
+}
+
+// New serves server, whose services must be registered already.
+func New(server *grpc.Server, opts ...Option) *Server {
+	s := &Server{
+		server:          server,
+		addr:            _defaultAddr,
+		notify:          make(chan error, 1),
+		shutdownTimeout: _defaultShutdownTimeout,
+	}
+
+	// Custom options
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.start()
+
+	return s
+}
+
+func (s *Server) start() {
+	// Listening before returning reports a port in use on Notify right away
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		s.notify <- err
+		close(s.notify)
+		return
+	}
+	s.lis = lis
+
+	go func() {
+		defer close(s.notify)
+
+		s.notify <- s.server.Serve(lis)
+	}()
+}
+
+// Notify -.
+func (s *Server) Notify() <-chan error {
+	return s.notify
+}
+
+// Shutdown stops accepting calls and waits for the pending ones, until the
+// shutdown timeout cancels them.
+func (s *Server) Shutdown() {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.server.Stop()
+	}
+
+	// A listener not yet served when stopping is only closed once it is, release its port now
+	if s.lis != nil {
+		s.lis.Close()
+	}
+}
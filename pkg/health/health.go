@@ -0,0 +1,134 @@
+// Package health aggregates the checks of the dependencies a service needs to
+// serve requests, for readiness probes.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of checks and reports.
+const (
+	StatusOK = "ok"
+	// StatusDegraded reports failing optional checks, the service still serves requests
+	StatusDegraded = "degraded"
+	StatusError    = "error"
+	// StatusDraining reports a service shutting down, which shouldn't get new requests
+	StatusDraining = "draining"
+)
+
+// Check returns an error when a dependency is not ready.
+type Check func(ctx context.Context) error
+
+type check struct {
+	name     string
+	check    Check
+	optional bool
+}
+
+// Checker runs the registered checks on demand. Checks are registered on
+// startup, before Ready is called.
+type Checker struct {
+	checks   []check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is the outcome of all checks.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether the service should get requests.
+func (r Report) Ready() bool {
+	return r.Status == StatusOK || r.Status == StatusDegraded
+}
+
+// New returns a checker whose checks time out after timeout.
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Register adds a check the service is not ready without.
+func (c *Checker) Register(name string, check Check) {
+	c.register(name, check, false)
+}
+
+// RegisterOptional adds a check whose failure is reported, but doesn't make
+// the service unready, e.g. of a dependency the service falls back from.
+func (c *Checker) RegisterOptional(name string, check Check) {
+	c.register(name, check, true)
+}
+
+func (c *Checker) register(name string, fn Check, optional bool) {
+	c.checks = append(c.checks, check{name: name, check: fn, optional: optional})
+}
+
+// Drain makes the service unready for good, so that load balancers stop
+// sending it requests before it shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs the checks concurrently and reports their results.
+func (c *Checker) Ready(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, ch)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[ch.name] = result
+			switch {
+			case result.Status == StatusOK:
+			case ch.optional && report.Status == StatusOK:
+				report.Status = StatusDegraded
+			case !ch.optional:
+				report.Status = StatusError
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.draining.Load() {
+		report.Status = StatusDraining
+	}
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, ch check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := ch.check(ctx)
+	result := Result{Status: StatusOK, Optional: ch.optional, Duration: time.Since(start).String()}
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+		err = errors.New("timed out")
+	}
+	if err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+	}
+
+	return result
+}
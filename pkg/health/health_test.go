@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("connection refused") }
+	hanging := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name     string
+		required []Check
+		optional []Check
+		status   string
+		ready    bool
+	}{
+		{name: "no checks", status: StatusOK, ready: true},
+		{name: "passing", required: []Check{ok}, optional: []Check{ok}, status: StatusOK, ready: true},
+		{name: "failing optional", required: []Check{ok}, optional: []Check{failing}, status: StatusDegraded, ready: true},
+		{name: "failing required", required: []Check{failing}, optional: []Check{ok}, status: StatusError},
+		{name: "failing both", required: []Check{failing}, optional: []Check{failing}, status: StatusError},
+		{name: "timing out", required: []Check{hanging}, status: StatusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(10 * time.Millisecond)
+			for i, check := range tt.required {
+				c.Register(string(rune('a'+i)), check)
+			}
+			for i, check := range tt.optional {
+				c.RegisterOptional(string(rune('A'+i)), check)
+			}
+
+			report := c.Ready(context.Background())
+			assert.Equal(t, tt.status, report.Status)
+			assert.Equal(t, tt.ready, report.Ready())
+			assert.Len(t, report.Checks, len(tt.required)+len(tt.optional))
+		})
+	}
+}
+
+func TestCheckerResults(t *testing.T) {
+	c := New(10 * time.Millisecond)
+	c.Register("repository", func(context.Context) error { return errors.New("dataset is empty") })
+	c.RegisterOptional("redis", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := c.Ready(context.Background())
+	assert.Equal(t, StatusError, report.Checks["repository"].Status)
+	assert.Equal(t, "dataset is empty", report.Checks["repository"].Error)
+	assert.False(t, report.Checks["repository"].Optional)
+	assert.Equal(t, "timed out", report.Checks["redis"].Error)
+	assert.True(t, report.Checks["redis"].Optional)
+}
+
+func TestDrain(t *testing.T) {
+	c := New(time.Second)
+	c.Register("repository", func(context.Context) error { return nil })
+	assert.True(t, c.Ready(context.Background()).Ready())
+
+	c.Drain()
+	report := c.Ready(context.Background())
+	assert.Equal(t, StatusDraining, report.Status)
+	assert.False(t, report.Ready())
+	// The checks are still reported
+	assert.Equal(t, StatusOK, report.Checks["repository"].Status)
+}
@@ -1,8 +1,11 @@
 package httpserver
 
 import (
+	"crypto/tls"
 	"net"
 	"time"
+
+	"github.com/ransoor2/ip2country/pkg/logger"
 )
 
 // Option -.
@@ -15,6 +18,14 @@ func Port(port string) Option {
 	}
 }
 
+// Host binds the server to host, e.g. an interface's address, instead of all
+// interfaces. It applies to the TLS port too.
+func Host(host string) Option {
+	return func(s *Server) {
+		s.host = host
+	}
+}
+
 // ReadTimeout -.
 func ReadTimeout(timeout time.Duration) Option {
 	return func(s *Server) {
@@ -29,9 +40,118 @@ func WriteTimeout(timeout time.Duration) Option {
 	}
 }
 
+// ReadHeaderTimeout -.
+func ReadHeaderTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.server.ReadHeaderTimeout = timeout
+	}
+}
+
+// IdleTimeout is how long keep-alive connections wait for the next request.
+func IdleTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.server.IdleTimeout = timeout
+	}
+}
+
+// MaxHeaderBytes -.
+func MaxHeaderBytes(n int) Option {
+	return func(s *Server) {
+		s.server.MaxHeaderBytes = n
+	}
+}
+
+// KeepAlives enables or disables HTTP keep-alives, which are enabled by default.
+func KeepAlives(enabled bool) Option {
+	return func(s *Server) {
+		s.server.SetKeepAlivesEnabled(enabled)
+	}
+}
+
+// MaxConns bounds the connections open at once on each listener. Further
+// connections wait in the listen backlog until one closes.
+func MaxConns(n int) Option {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
 // ShutdownTimeout -.
 func ShutdownTimeout(timeout time.Duration) Option {
 	return func(s *Server) {
 		s.shutdownTimeout = timeout
 	}
 }
+
+// H2C serves HTTP/2 over the plaintext listeners too, to clients with prior
+// knowledge or upgrading from HTTP/1.1, e.g. the proxies of a service mesh.
+func H2C() Option {
+	return func(s *Server) {
+		s.h2c = true
+	}
+}
+
+// UnixSocket serves plaintext HTTP on the Unix domain socket at path, next to
+// the server port, e.g. for sidecars on the same host.
+func UnixSocket(path string) Option {
+	return func(s *Server) {
+		s.unixSocket = path
+	}
+}
+
+// Logger reports the certificate reloads.
+func Logger(l logger.Interface) Option {
+	return func(s *Server) {
+		s.log = l
+	}
+}
+
+// TLS serves HTTPS with the certificate and key files, which are reloaded
+// when they change. The server port serves HTTPS only, unless TLSPort is set.
+func TLS(certFile, keyFile string) Option {
+	return func(s *Server) {
+		s.certFile = certFile
+		s.keyFile = keyFile
+	}
+}
+
+// TLSPort serves HTTPS on port, next to plaintext HTTP on the server port.
+func TLSPort(port string) Option {
+	return func(s *Server) {
+		s.tlsAddr = net.JoinHostPort("", port)
+	}
+}
+
+// TLSMinVersion -.
+func TLSMinVersion(version uint16) Option {
+	return func(s *Server) {
+		s.tlsConfig.MinVersion = version
+	}
+}
+
+// TLSCipherSuites restricts the cipher suites of TLS 1.2 connections.
+func TLSCipherSuites(suites []uint16) Option {
+	return func(s *Server) {
+		s.tlsConfig.CipherSuites = suites
+	}
+}
+
+// ClientCAs verifies client certificates against the CA bundle file, which is
+// reloaded along with the certificate. Clients without a certificate are
+// rejected if required, and served without an identity otherwise.
+func ClientCAs(caFile string, required bool) Option {
+	return func(s *Server) {
+		s.clientCAFile = caFile
+		s.tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if required {
+			s.tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+}
+
+// CertReloadInterval is how often the certificate files are checked for changes.
+func CertReloadInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.certReloadInterval = interval
+	}
+}
@@ -3,15 +3,29 @@ package httpserver
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"sync"
 	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+
+	"github.com/ransoor2/ip2country/pkg/logger"
 )
 
 const (
-	_defaultReadTimeout     = 5 * time.Second
-	_defaultWriteTimeout    = 5 * time.Second
-	_defaultAddr            = ":80"
-	_defaultShutdownTimeout = 3 * time.Second
+	_defaultReadTimeout        = 5 * time.Second
+	_defaultWriteTimeout       = 5 * time.Second
+	_defaultAddr               = ":80"
+	_defaultShutdownTimeout    = 3 * time.Second
+	_defaultCertReloadInterval = time.Minute
+	_defaultTLSMinVersion      = tls.VersionTLS12
 )
 
 // Server -.
@@ -19,6 +33,22 @@ type Server struct {
 	server          *http.Server
 	notify          chan error
 	shutdownTimeout time.Duration
+	log             logger.Interface
+	host            string
+	maxConns        int
+	h2c             bool
+	unixSocket      string
+	listeners       []listener
+
+	// TLS
+	certFile           string
+	keyFile            string
+	clientCAFile       string
+	tlsAddr            string
+	tlsConfig          *tls.Config
+	certReloadInterval time.Duration
+	done               chan struct{}
+	closeOnce          sync.Once
 }
 
 // New -.
@@ -31,9 +61,11 @@ func New(handler http.Handler, opts ...Option) *Server {
 	}
 
 	s := &Server{
-		server:          httpServer,
-		notify:          make(chan error, 1),
-		shutdownTimeout: _defaultShutdownTimeout,
+		server:             httpServer,
+		shutdownTimeout:    _defaultShutdownTimeout,
+		tlsConfig:          &tls.Config{MinVersion: _defaultTLSMinVersion},
+		certReloadInterval: _defaultCertReloadInterval,
+		done:               make(chan struct{}),
 	}
 
 	// Custom options
@@ -41,18 +73,177 @@ func New(handler http.Handler, opts ...Option) *Server {
 		opt(s)
 	}
 
+	if s.host != "" {
+		s.server.Addr = withHost(s.server.Addr, s.host)
+		s.tlsAddr = withHost(s.tlsAddr, s.host)
+	}
+
 	s.start()
 
 	return s
 }
 
+// listener serves the server on a listener.
+type listener struct {
+	net.Listener
+	serve func(net.Listener) error
+}
+
+// start serves plaintext HTTP on the server address, and HTTPS on the TLS
+// address if there is one. Without a TLS address, the server address serves
+// HTTPS instead when a certificate is configured. The Unix socket, if any,
+// serves plaintext HTTP too.
 func (s *Server) start() {
+	listeners, err := s.listen()
+	if err != nil {
+		s.notify = make(chan error, 1)
+		s.notify <- err
+		close(s.notify)
+		return
+	}
+
+	s.listeners = listeners
+	s.notify = make(chan error, len(listeners))
+
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.notify <- l.serve(l.Listener)
+		}()
+	}
+
 	go func() {
-		s.notify <- s.server.ListenAndServe()
+		wg.Wait()
 		close(s.notify)
 	}()
 }
 
+func (s *Server) listen() ([]listener, error) {
+	serveTLS := func(l net.Listener) error { return s.server.ServeTLS(l, "", "") }
+
+	var plainAddr, tlsAddr string
+	switch {
+	case s.certFile == "":
+		plainAddr = s.server.Addr
+	case s.tlsAddr == "":
+		tlsAddr = s.server.Addr
+	default:
+		plainAddr, tlsAddr = s.server.Addr, s.tlsAddr
+	}
+
+	if tlsAddr != "" {
+		certs, err := newCertificates(s.certFile, s.keyFile, s.clientCAFile, s.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		s.server.TLSConfig = certs.tlsConfig()
+		if s.certReloadInterval > 0 {
+			go s.watch(certs)
+		}
+	}
+
+	if s.h2c {
+		// Configured on the server, HTTP/2 connections are closed gracefully on shutdown, h2c ones included
+		h2s := &http2.Server{}
+		if err := http2.ConfigureServer(s.server, h2s); err != nil {
+			return nil, fmt.Errorf("httpserver - listen - http2.ConfigureServer: %w", err)
+		}
+		s.server.Handler = h2c.NewHandler(s.server.Handler, h2s)
+	}
+
+	var listeners []listener
+	for _, l := range []struct {
+		network string
+		addr    string
+		serve   func(net.Listener) error
+	}{
+		{network: "tcp", addr: plainAddr, serve: s.server.Serve},
+		{network: "tcp", addr: tlsAddr, serve: serveTLS},
+		{network: "unix", addr: s.unixSocket, serve: s.server.Serve},
+	} {
+		if l.addr == "" {
+			continue
+		}
+
+		ln, err := listenOn(l.network, l.addr)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		if s.maxConns > 0 {
+			ln = netutil.LimitListener(ln, s.maxConns)
+		}
+		listeners = append(listeners, listener{Listener: ln, serve: l.serve})
+	}
+
+	return listeners, nil
+}
+
+// withHost replaces the host of addr, if there is an address.
+func withHost(addr, host string) string {
+	if addr == "" {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// listenOn listens on a TCP address or a Unix socket path. A socket left at
+// the path by a process that didn't shut down cleanly is removed first, as
+// the socket is otherwise removed when its listener is closed.
+func listenOn(network, addr string) (net.Listener, error) {
+	if network == "unix" {
+		info, err := os.Lstat(addr)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("httpserver - listenOn - os.Lstat: %w", err)
+		case info.Mode()&os.ModeSocket == 0:
+			return nil, fmt.Errorf("httpserver - listenOn: %s exists and is not a socket", addr)
+		default:
+			if err := os.Remove(addr); err != nil {
+				return nil, fmt.Errorf("httpserver - listenOn - os.Remove: %w", err)
+			}
+		}
+	}
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("httpserver - listenOn: %w", err)
+	}
+
+	return ln, nil
+}
+
+// watch reloads the certificates when their files change, until shutdown.
+func (s *Server) watch(certs *certificates) {
+	ticker := time.NewTicker(s.certReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			reloaded, err := certs.reloadIfChanged()
+			switch {
+			case err != nil && s.log != nil:
+				s.log.Error(fmt.Errorf("httpserver - watch: %w", err))
+			case reloaded && s.log != nil:
+				s.log.Info("httpserver - watch - reloaded %s", s.certFile)
+			}
+		}
+	}
+}
+
 // Notify -.
 func (s *Server) Notify() <-chan error {
 	return s.notify
@@ -60,8 +251,17 @@ func (s *Server) Notify() <-chan error {
 
 // Shutdown -.
 func (s *Server) Shutdown() error {
+	s.closeOnce.Do(func() { close(s.done) })
+
 	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 	defer cancel()
 
-	return s.server.Shutdown(ctx)
+	err := s.server.Shutdown(ctx)
+
+	// Listeners not yet served when shutting down are only closed once they are, release their ports now
+	for _, l := range s.listeners {
+		l.Close()
+	}
+
+	return err
 }
@@ -0,0 +1,122 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+// protoHandler echoes the protocol of requests.
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.WriteString(w, r.Proto)
+})
+
+func getBody(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+
+	res, err := client.Get(url)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+
+	return string(body)
+}
+
+func TestH2C(t *testing.T) {
+	server := New(protoHandler, Port("18081"), H2C())
+	defer server.Shutdown()
+
+	// HTTP/2 with prior knowledge, as the proxies of a service mesh speak it
+	h2Client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	assert.Equal(t, "HTTP/2.0", getBody(t, h2Client, "http://localhost:18081/"))
+
+	// HTTP/1.1 clients are still served
+	assert.Equal(t, "HTTP/1.1", getBody(t, http.DefaultClient, "http://localhost:18081/"))
+}
+
+func TestUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ip2country.sock")
+
+	// A socket left by a previous process is replaced
+	stale, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	server := New(protoHandler, Port("18082"), UnixSocket(socket))
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	assert.Equal(t, "HTTP/1.1", getBody(t, client, "http://unix/"))
+	assert.Equal(t, "HTTP/1.1", getBody(t, http.DefaultClient, "http://localhost:18082/"))
+
+	// The socket is removed on shutdown
+	assert.NoError(t, server.Shutdown())
+	_, err = os.Stat(socket)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestUnixSocketNotASocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	assert.NoError(t, os.WriteFile(path, []byte("[]"), 0600))
+
+	server := New(protoHandler, Port("18083"), UnixSocket(path))
+	defer server.Shutdown()
+
+	// Regular files are never removed
+	assert.Error(t, <-server.Notify())
+	_, err := os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestMaxConns(t *testing.T) {
+	server := New(protoHandler, Host("127.0.0.1"), Port("18084"), MaxConns(1))
+	defer server.Shutdown()
+
+	// An idle connection holds the only slot
+	conn, err := net.Dial("tcp", "127.0.0.1:18084")
+	assert.NoError(t, err)
+
+	served := make(chan string)
+	go func() {
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		served <- getBody(t, client, "http://127.0.0.1:18084/")
+	}()
+
+	select {
+	case <-served:
+		t.Error("Expected the second connection to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// It is served once the slot is released
+	conn.Close()
+	select {
+	case body := <-served:
+		assert.Equal(t, "HTTP/1.1", body)
+	case <-time.After(time.Second):
+		t.Error("Expected the second connection to be served")
+	}
+}
@@ -0,0 +1,142 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// tlsVersions are the versions accepted by ParseTLSVersion, older ones are insecure.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion returns the TLS version of a name like "1.2".
+func ParseTLSVersion(name string) (uint16, error) {
+	version, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("httpserver - ParseTLSVersion: unsupported TLS version %q", name)
+	}
+
+	return version, nil
+}
+
+// ParseCipherSuites returns the IDs of cipher suites named like
+// "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256". Only the suites of tls.CipherSuites
+// are accepted, the insecure ones are not. They apply to TLS 1.2, as the
+// suites of TLS 1.3 are not configurable.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(tls.CipherSuites(), func(s *tls.CipherSuite) bool { return s.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("httpserver - ParseCipherSuites: unsupported cipher suite %q", name)
+		}
+		suites = append(suites, tls.CipherSuites()[i].ID)
+	}
+
+	return suites, nil
+}
+
+// nextProtos are the protocols negotiated by ALPN.
+var nextProtos = []string{"h2", "http/1.1"}
+
+// certificates holds the TLS configuration of the certificate, key and client
+// CA files, and rebuilds it when the files change. Handshakes get the current
+// configuration, so that reloads don't affect established connections.
+type certificates struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	// base holds the settings besides the files: versions, cipher suites and client authentication.
+	base     *tls.Config
+	config   atomic.Pointer[tls.Config]
+	modTimes []time.Time
+}
+
+func newCertificates(certFile, keyFile, caFile string, base *tls.Config) (*certificates, error) {
+	c := &certificates{certFile: certFile, keyFile: keyFile, caFile: caFile, base: base}
+	if _, err := c.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// tlsConfig returns the configuration of the server, which resolves to the current one on every handshake.
+func (c *certificates) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: c.base.MinVersion,
+		// HTTP/2 is only set up for servers advertising it, whichever listener is served first
+		NextProtos: slices.Clone(nextProtos),
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &c.config.Load().Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return c.config.Load(), nil
+		},
+	}
+}
+
+// reloadIfChanged rebuilds the configuration if any of the files changed
+// since the last load, and reports whether it did. The current configuration
+// is kept on error, e.g. while the files are being replaced.
+func (c *certificates) reloadIfChanged() (bool, error) {
+	modTimes, err := c.stat()
+	if err != nil {
+		return false, err
+	}
+	if slices.Equal(modTimes, c.modTimes) {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("httpserver - certificates - tls.LoadX509KeyPair: %w", err)
+	}
+
+	config := c.base.Clone()
+	config.Certificates = []tls.Certificate{cert}
+	// GetConfigForClient replaces the server's configuration, ALPN included
+	config.NextProtos = slices.Clone(nextProtos)
+
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return false, fmt.Errorf("httpserver - certificates - os.ReadFile: %w", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return false, errors.New("httpserver - certificates: no certificates in the client CA file")
+		}
+	}
+
+	c.config.Store(config)
+	c.modTimes = modTimes
+
+	return true, nil
+}
+
+func (c *certificates) stat() ([]time.Time, error) {
+	files := []string{c.certFile, c.keyFile}
+	if c.caFile != "" {
+		files = append(files, c.caFile)
+	}
+
+	modTimes := make([]time.Time, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("httpserver - certificates - os.Stat: %w", err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	return modTimes, nil
+}
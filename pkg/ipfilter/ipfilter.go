@@ -0,0 +1,239 @@
+// Package ipfilter matches client addresses against allowed and denied networks.
+package ipfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+// Action is the outcome of matching an address.
+type Action int
+
+const (
+	// None means the address is in neither list.
+	None Action = iota
+	// Allow means the address is in an allowed network.
+	Allow
+	// Deny means the address is in a denied network. Deny takes precedence over Allow.
+	Deny
+)
+
+// Lists are the allowed and denied networks, in CIDR notation or as single addresses.
+type Lists struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+type prefixes struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// Filter matches addresses against the configured lists and those of the
+// lists file, which is reloaded whenever it changes.
+type Filter struct {
+	log        logger.Interface
+	static     Lists
+	file       string
+	mu         sync.Mutex // serializes reloads
+	modTime    time.Time
+	allowLimit *ratelimiter.Limit
+	prefixes   atomic.Pointer[prefixes]
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+func New(cfg config.IPFilter, l logger.Interface) (*Filter, error) {
+	f := &Filter{
+		log:    l,
+		static: Lists{Allow: cfg.Allow, Deny: cfg.Deny},
+		file:   cfg.File,
+		done:   make(chan struct{}),
+	}
+
+	if cfg.AllowRequests > 0 {
+		f.allowLimit = &ratelimiter.Limit{
+			Requests: cfg.AllowRequests,
+			Burst:    cfg.AllowBurst,
+			Interval: cfg.AllowInterval,
+		}
+	}
+
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+
+	if f.file != "" && cfg.ReloadInterval > 0 {
+		go f.watch(cfg.ReloadInterval)
+	}
+
+	return f, nil
+}
+
+// Match returns the action for the address ip.
+func (f *Filter) Match(ip string) Action {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return None
+	}
+	addr = addr.Unmap()
+
+	p := f.prefixes.Load()
+	for _, prefix := range p.deny {
+		if prefix.Contains(addr) {
+			return Deny
+		}
+	}
+	for _, prefix := range p.allow {
+		if prefix.Contains(addr) {
+			return Allow
+		}
+	}
+
+	return None
+}
+
+// AllowLimit returns the limit of allowed addresses, nil if they bypass rate limiting.
+func (f *Filter) AllowLimit() *ratelimiter.Limit {
+	return f.allowLimit
+}
+
+// Reload rereads the lists file. The current lists are kept on error.
+func (f *Filter) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.reload()
+}
+
+func (f *Filter) reload() error {
+	lists := Lists{
+		Allow: f.static.Allow[:len(f.static.Allow):len(f.static.Allow)],
+		Deny:  f.static.Deny[:len(f.static.Deny):len(f.static.Deny)],
+	}
+
+	var modTime time.Time
+	if f.file != "" {
+		info, err := os.Stat(f.file)
+		if err != nil {
+			return fmt.Errorf("ipfilter - Reload - os.Stat: %w", err)
+		}
+
+		fileLists, err := readFile(f.file)
+		if err != nil {
+			return err
+		}
+
+		modTime = info.ModTime()
+		lists.Allow = append(lists.Allow, fileLists.Allow...)
+		lists.Deny = append(lists.Deny, fileLists.Deny...)
+	}
+
+	p := &prefixes{}
+	var err error
+	if p.allow, err = parsePrefixes(lists.Allow); err != nil {
+		return err
+	}
+	if p.deny, err = parsePrefixes(lists.Deny); err != nil {
+		return err
+	}
+
+	f.prefixes.Store(p)
+	// Lists that failed to load are retried until they do, even if the file doesn't change again
+	f.modTime = modTime
+
+	return nil
+}
+
+// Close stops watching the lists file.
+func (f *Filter) Close() {
+	f.closeOnce.Do(func() { close(f.done) })
+}
+
+func (f *Filter) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			reloaded, err := f.reloadIfChanged()
+			if err != nil {
+				f.log.Error(fmt.Errorf("ipfilter - watch: %w", err))
+				continue
+			}
+			if reloaded {
+				f.log.Info("ipfilter - watch - reloaded %s", f.file)
+			}
+		}
+	}
+}
+
+func (f *Filter) reloadIfChanged() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.file)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return false, nil
+	}
+
+	return true, f.reload()
+}
+
+func readFile(path string) (Lists, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Lists{}, fmt.Errorf("ipfilter - readFile: %w", err)
+	}
+
+	var lists Lists
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return Lists{}, fmt.Errorf("ipfilter - readFile: %w", err)
+	}
+
+	return lists, nil
+}
+
+// parsePrefixes parses networks in CIDR notation, or single addresses.
+func parsePrefixes(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		network = strings.TrimSpace(network)
+		if !strings.Contains(network, "/") {
+			addr, err := netip.ParseAddr(network)
+			if err != nil {
+				return nil, fmt.Errorf("ipfilter - parsePrefixes: %w", err)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("ipfilter - parsePrefixes: %w", err)
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
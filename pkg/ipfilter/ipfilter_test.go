@@ -0,0 +1,90 @@
+package ipfilter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+func TestMatch(t *testing.T) {
+	cfg := config.IPFilter{
+		Allow: []string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.7"},
+		Deny:  []string{"10.6.6.0/24", "2001:db8:bad::/48"},
+	}
+	f, err := New(cfg, logger.New("debug"))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	testCases := []struct {
+		ip     string
+		action Action
+	}{
+		{"10.1.2.3", Allow},
+		{"10.6.6.6", Deny},
+		{"::ffff:10.1.2.3", Allow},
+		{"192.168.1.7", Allow},
+		{"192.168.1.8", None},
+		{"2001:db8:1::1", Allow},
+		{"2001:db8:bad::1", Deny},
+		{"2001:db9::1", None},
+		{"not an ip", None},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.action, f.Match(tc.ip), tc.ip)
+	}
+
+	assert.Nil(t, f.AllowLimit())
+}
+
+func TestReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lists.json")
+	err := os.WriteFile(file, []byte(`{"deny": ["203.0.113.0/24"]}`), 0600)
+	assert.NoError(t, err)
+
+	cfg := config.IPFilter{
+		Allow:          []string{"198.51.100.0/24"},
+		File:           file,
+		ReloadInterval: 10 * time.Millisecond,
+		AllowRequests:  1000,
+		AllowInterval:  time.Second,
+	}
+	f, err := New(cfg, logger.New("debug"))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	assert.Equal(t, Deny, f.Match("203.0.113.9"))
+	assert.Equal(t, Allow, f.Match("198.51.100.9"))
+	assert.Equal(t, 1000, f.AllowLimit().Requests)
+
+	// Changes to the file are picked up without a restart
+	err = os.WriteFile(file, []byte(`{"deny": ["198.51.100.9"]}`), 0600)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Second)))
+
+	assert.Eventually(t, func() bool { return f.Match("198.51.100.9") == Deny }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, None, f.Match("203.0.113.9"))
+
+	// Invalid lists keep the current ones
+	err = os.WriteFile(file, []byte(`{"deny": ["bogus"]}`), 0600)
+	assert.NoError(t, err)
+	assert.Error(t, f.Reload())
+	assert.Equal(t, Deny, f.Match("198.51.100.9"))
+
+	// and are retried until they load, even if the file keeps its modification time
+	modTime := time.Now().Add(2 * time.Second)
+	assert.NoError(t, os.Chtimes(file, modTime, modTime))
+	reloaded, err := f.reloadIfChanged()
+	assert.Error(t, err)
+	assert.True(t, reloaded)
+	err = os.WriteFile(file, []byte(`{"deny": ["203.0.113.0/24"]}`), 0600)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chtimes(file, modTime, modTime))
+	assert.Eventually(t, func() bool { return f.Match("203.0.113.9") == Deny }, time.Second, 10*time.Millisecond)
+}
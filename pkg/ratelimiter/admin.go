@@ -0,0 +1,91 @@
+package ratelimiter
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ransoor2/ip2country/config"
+)
+
+// ErrNotFound is returned for keys without a bucket, e.g. keys of idle clients.
+var ErrNotFound = errors.New("key not found")
+
+// KeyState is a snapshot of a key's bucket.
+type KeyState struct {
+	Key string
+	// Limit is the maximum number of requests the key may have available.
+	Limit int
+	// Remaining is the number of requests available now.
+	Remaining int
+	// Reset is the time until all requests are available again.
+	Reset time.Duration
+	// LastRefill is the last time tokens were added to the bucket. It is
+	// only recorded by token buckets, and zero for the other algorithms.
+	LastRefill time.Time
+	// TTL is the time until the bucket is dropped if the key makes no requests.
+	TTL time.Duration
+}
+
+// used is the number of requests the key used out of its limit.
+func (s KeyState) used() int {
+	return s.Limit - s.Remaining
+}
+
+// topConsumers returns the n states that used the most of their limit.
+func topConsumers(states []KeyState, n int) []KeyState {
+	slices.SortFunc(states, func(a, b KeyState) int {
+		return cmp.Or(cmp.Compare(b.used(), a.used()), strings.Compare(a.Key, b.Key))
+	})
+
+	return states[:min(n, len(states))]
+}
+
+// isQuotaKey reports whether key is the key of a quota rather than of a bucket.
+func isQuotaKey(key string) bool {
+	return strings.HasPrefix(key, "quota:")
+}
+
+// Limits are the configured limits that can be changed at runtime.
+type Limits struct {
+	MaxRequests  int
+	UserRequests int
+	Interval     time.Duration
+}
+
+// limits holds the current global and per client limits of a limiter.
+type limits struct {
+	burst     int
+	userBurst int
+	current   atomic.Pointer[Limits]
+}
+
+func newLimits(cfg config.RateLimiter) *limits {
+	l := &limits{burst: cfg.Burst, userBurst: cfg.UserBurst}
+	l.current.Store(&Limits{MaxRequests: cfg.MaxRequests, UserRequests: cfg.UserRequests, Interval: cfg.Interval})
+
+	return l
+}
+
+func (l *limits) get() Limits {
+	return *l.current.Load()
+}
+
+func (l *limits) set(limits Limits) {
+	l.current.Store(&limits)
+}
+
+func (l *limits) global() limit {
+	c := l.current.Load()
+
+	return newLimit(c.MaxRequests, l.burst, c.Interval)
+}
+
+func (l *limits) client() limit {
+	c := l.current.Load()
+
+	return newLimit(c.UserRequests, l.userBurst, c.Interval)
+}
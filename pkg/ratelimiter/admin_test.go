@@ -0,0 +1,179 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+// admin is the inspection and tuning interface shared by the limiters.
+type admin interface {
+	Limiter
+	Inspect(ctx context.Context, key string) (KeyState, error)
+	TopConsumers(ctx context.Context, n int) ([]KeyState, error)
+	Reset(ctx context.Context, key string) error
+	Limits() Limits
+	SetLimits(ctx context.Context, l Limits) error
+}
+
+// testAdmin checks the admin interface of rl, limited to 10 requests per second and 5 per client.
+func testAdmin(t *testing.T, rl admin) {
+	t.Helper()
+	ctx := context.Background()
+
+	for range 3 {
+		assert.True(t, rl.Allow(ctx, Request{Key: "10.0.0.1"}).Allowed)
+	}
+	assert.True(t, rl.Allow(ctx, Request{Key: "10.0.0.2"}).Allowed)
+
+	state, err := rl.Inspect(ctx, "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", state.Key)
+	assert.Equal(t, 5, state.Limit)
+	assert.Equal(t, 2, state.Remaining)
+	assert.False(t, state.LastRefill.IsZero())
+	assert.Positive(t, state.TTL)
+
+	state, err = rl.Inspect(ctx, global)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, state.Limit)
+	assert.Equal(t, 6, state.Remaining)
+
+	_, err = rl.Inspect(ctx, "10.0.0.3")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	top, err := rl.TopConsumers(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, top, 1)
+	assert.Equal(t, "10.0.0.1", top[0].Key)
+
+	top, err = rl.TopConsumers(ctx, 10)
+	assert.NoError(t, err)
+	assert.Len(t, top, 2)
+
+	assert.NoError(t, rl.Reset(ctx, "10.0.0.1"))
+	_, err = rl.Inspect(ctx, "10.0.0.1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, rl.Reset(ctx, "10.0.0.1"), ErrNotFound)
+
+	// New limits apply to the next requests
+	assert.NoError(t, rl.SetLimits(ctx, Limits{MaxRequests: 10, UserRequests: 1, Interval: time.Minute}))
+	assert.Equal(t, Limits{MaxRequests: 10, UserRequests: 1, Interval: time.Minute}, rl.Limits())
+	assert.True(t, rl.Allow(ctx, Request{Key: "10.0.0.4"}).Allowed)
+	assert.False(t, rl.Allow(ctx, Request{Key: "10.0.0.4"}).Allowed)
+}
+
+func TestLocalRateLimiterAdmin(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:   10,
+		UserRequests:  5,
+		Interval:      time.Second,
+		BucketTTL:     time.Minute,
+		CleanInterval: time.Minute,
+	}
+
+	testAdmin(t, NewLocalRateLimiter(cfg, logger.New("debug")))
+}
+
+func TestDistributedRateLimiterAdmin(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:  10,
+		UserRequests: 5,
+		Interval:     time.Second,
+	}
+	rl, _ := newTestDistributedRateLimiter(t, cfg)
+
+	testAdmin(t, rl)
+}
+
+func TestDistributedRateLimiterSharedLimits(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:  10,
+		UserRequests: 5,
+		Interval:     time.Second,
+	}
+	rl, mr := newTestDistributedRateLimiter(t, cfg)
+	cfg.RedisAddr = mr.Addr()
+	other, err := NewDistributedRateLimiter(cfg, logger.New("debug"))
+	assert.NoError(t, err)
+	t.Cleanup(other.Close)
+
+	// Limits changed on a replica apply to the others once they read them
+	limits := Limits{MaxRequests: 10, UserRequests: 1, Interval: time.Minute}
+	assert.NoError(t, rl.SetLimits(context.Background(), limits))
+	assert.NoError(t, other.refreshLimits(context.Background()))
+	assert.Equal(t, limits, other.Limits())
+	assert.True(t, other.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+	assert.False(t, other.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+
+	// and to replicas started afterwards
+	restarted, err := NewDistributedRateLimiter(cfg, logger.New("debug"))
+	assert.NoError(t, err)
+	t.Cleanup(restarted.Close)
+	assert.Equal(t, limits, restarted.Limits())
+
+	// The stored limits are no bucket
+	top, err := rl.TopConsumers(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, top, 1)
+}
+
+func TestDistributedInspectAlgorithms(t *testing.T) {
+	for _, tc := range algorithmTests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			cfg := config.RateLimiter{
+				Algorithm:    tc.algorithm,
+				MaxRequests:  100,
+				UserRequests: 5,
+				Interval:     time.Second,
+			}
+			rl, _ := newTestDistributedRateLimiter(t, cfg)
+
+			for range 2 {
+				assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+			}
+
+			state, err := rl.Inspect(context.Background(), "10.0.0.1")
+			assert.NoError(t, err)
+			assert.Equal(t, 3, state.Remaining)
+			assert.Positive(t, state.TTL)
+			// Only token buckets record their refills
+			if tc.algorithm == AlgorithmTokenBucket {
+				assert.Equal(t, testNow, state.LastRefill.UTC())
+			} else {
+				assert.True(t, state.LastRefill.IsZero())
+			}
+		})
+	}
+}
+
+func TestHybridRateLimiterInspect(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(testNow)
+	cfg := config.RateLimiter{
+		MaxRequests:  100,
+		UserRequests: 10,
+		Interval:     time.Second,
+		LeaseSize:    5,
+	}
+	rl := newTestHybridRateLimiter(t, cfg, mr)
+
+	for range 3 {
+		assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+	}
+
+	// Requests admitted under the lease count although Redis doesn't know about them yet
+	state, err := rl.Inspect(context.Background(), "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, state.Remaining)
+
+	assert.NoError(t, rl.Reset(context.Background(), "10.0.0.1"))
+	_, err = rl.Inspect(context.Background(), "10.0.0.1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
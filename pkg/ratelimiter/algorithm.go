@@ -0,0 +1,243 @@
+package ratelimiter
+
+import (
+	"math"
+	"time"
+)
+
+// Algorithms accepted by config.RateLimiter.Algorithm.
+const (
+	AlgorithmTokenBucket          = "token_bucket"
+	AlgorithmSlidingWindowLog     = "sliding_window_log"
+	AlgorithmSlidingWindowCounter = "sliding_window_counter"
+	AlgorithmGCRA                 = "gcra"
+)
+
+// limit describes the allowed rate of a single key: requests per interval,
+// with bursts of up to burst requests where the algorithm supports it.
+type limit struct {
+	requests int
+	burst    int
+	interval time.Duration
+}
+
+// newLimit returns a limit of requests per interval.
+// A non-positive burst defaults to requests.
+func newLimit(requests, burst int, interval time.Duration) limit {
+	if burst <= 0 {
+		burst = requests
+	}
+
+	return limit{requests: requests, burst: burst, interval: interval}
+}
+
+// emissionInterval is the time it takes to earn a single request.
+func (l limit) emissionInterval() time.Duration {
+	return l.interval / time.Duration(l.requests)
+}
+
+// usage describes where a key stands against its limit.
+type usage struct {
+	// limit is the maximum number of requests the key may have available.
+	limit int
+	// remaining is the number of requests available now.
+	remaining int
+	// reset is the time until all requests are available again.
+	reset time.Duration
+	// retryAfter is the time until the next request is admitted, zero if it is admitted now.
+	// Requests costing more than limit are never admitted, see Decision.CostExceedsLimit.
+	retryAfter time.Duration
+}
+
+// state is the per-key state of a rate limiting algorithm.
+type state interface {
+	// usage brings the state up to now and reports the key's usage, for a request of cost requests.
+	usage(l limit, now time.Time, cost int) usage
+	// consume records a request of cost requests previously admitted by usage.
+	consume(l limit, now time.Time, cost int)
+}
+
+// newStateFunc returns the constructor of per-key states for the algorithm.
+// Token bucket is used when no algorithm is set.
+func newStateFunc(algorithm string) func(l limit, now time.Time) state {
+	switch algorithm {
+	case AlgorithmSlidingWindowLog:
+		return func(limit, time.Time) state { return &slidingWindowLog{} }
+	case AlgorithmSlidingWindowCounter:
+		return func(limit, time.Time) state { return &slidingWindowCounter{} }
+	case AlgorithmGCRA:
+		return func(_ limit, now time.Time) state { return &gcra{tat: now} }
+	default:
+		return func(l limit, now time.Time) state { return &tokenBucket{tokens: float64(l.burst), lastCheck: now} }
+	}
+}
+
+// tokenBucket holds up to burst tokens and refills continuously at
+// requests tokens per interval.
+type tokenBucket struct {
+	tokens    float64
+	lastCheck time.Time
+}
+
+func (b *tokenBucket) usage(l limit, now time.Time, cost int) usage {
+	if elapsed := now.Sub(b.lastCheck); elapsed > 0 {
+		b.tokens = min(float64(l.burst), b.tokens+float64(l.requests)*float64(elapsed)/float64(l.interval))
+		b.lastCheck = now
+	}
+
+	tokenTime := float64(l.emissionInterval())
+
+	return usage{
+		limit:      l.burst,
+		remaining:  int(b.tokens),
+		reset:      time.Duration((float64(l.burst) - b.tokens) * tokenTime),
+		retryAfter: time.Duration(max(0, float64(cost)-b.tokens) * tokenTime),
+	}
+}
+
+func (b *tokenBucket) consume(_ limit, _ time.Time, cost int) {
+	b.tokens -= float64(cost)
+}
+
+// slidingWindowLog admits at most requests within any interval by keeping
+// the timestamp of every admitted request.
+type slidingWindowLog struct {
+	log []time.Time
+}
+
+func (w *slidingWindowLog) usage(l limit, now time.Time, cost int) usage {
+	windowStart := now.Add(-l.interval)
+
+	expired := 0
+	for expired < len(w.log) && !w.log[expired].After(windowStart) {
+		expired++
+	}
+	w.log = w.log[expired:]
+
+	u := usage{limit: l.requests, remaining: max(0, l.requests-len(w.log))}
+	if len(w.log) > 0 {
+		u.reset = w.log[len(w.log)-1].Add(l.interval).Sub(now)
+	}
+	switch expiring := len(w.log) + cost - l.requests; {
+	case cost > l.requests:
+		u.retryAfter = l.interval
+	case expiring > 0:
+		// The oldest requests have to leave the window first
+		u.retryAfter = w.log[expiring-1].Add(l.interval).Sub(now)
+	}
+
+	return u
+}
+
+func (w *slidingWindowLog) consume(_ limit, now time.Time, cost int) {
+	for range cost {
+		w.log = append(w.log, now)
+	}
+}
+
+// slidingWindowCounter approximates a sliding window by weighting the
+// previous fixed window's count by its overlap with the sliding window.
+type slidingWindowCounter struct {
+	window   time.Time
+	current  int
+	previous int
+}
+
+func (w *slidingWindowCounter) usage(l limit, now time.Time, cost int) usage {
+	window := now.Truncate(l.interval)
+	switch {
+	case window.Equal(w.window):
+	case window.Equal(w.window.Add(l.interval)):
+		w.previous, w.current = w.current, 0
+	default:
+		w.previous, w.current = 0, 0
+	}
+	w.window = window
+
+	elapsed := float64(now.Sub(window)) / float64(l.interval)
+	current, previous, requests, n := float64(w.current), float64(w.previous), float64(l.requests), float64(cost)
+	estimate := previous*(1-elapsed) + current
+
+	u := usage{limit: l.requests, remaining: max(0, int(requests-estimate))}
+
+	switch {
+	case w.current > 0:
+		u.reset = window.Add(2 * l.interval).Sub(now)
+	case w.previous > 0:
+		u.reset = window.Add(l.interval).Sub(now)
+	}
+
+	switch {
+	case estimate+n <= requests:
+	case n > requests:
+		u.retryAfter = l.interval
+	case current+n <= requests:
+		// Wait for the previous window's weight to drop enough
+		u.retryAfter = time.Duration((1 - (requests-current-n)/previous - elapsed) * float64(l.interval))
+	default:
+		// Wait for the current window to become the previous one and lose enough weight
+		u.retryAfter = time.Duration((2 - (requests-n)/current - elapsed) * float64(l.interval))
+	}
+
+	return u
+}
+
+func (w *slidingWindowCounter) consume(_ limit, _ time.Time, cost int) {
+	w.current += cost
+}
+
+// gcra implements the generic cell rate algorithm. It tracks the theoretical
+// arrival time (TAT) of the next request and admits a request as long as the
+// TAT is no further ahead than the burst allows.
+type gcra struct {
+	tat time.Time
+}
+
+func (g *gcra) usage(l limit, now time.Time, cost int) usage {
+	if g.tat.Before(now) {
+		g.tat = now
+	}
+
+	emission := l.emissionInterval()
+	tolerance := emission * time.Duration(l.burst)
+	ahead := g.tat.Sub(now)
+
+	return usage{
+		limit:      l.burst,
+		remaining:  int(math.Floor(float64(tolerance-ahead) / float64(emission))),
+		reset:      ahead,
+		retryAfter: max(0, ahead+emission*time.Duration(cost)-tolerance),
+	}
+}
+
+func (g *gcra) consume(l limit, _ time.Time, cost int) {
+	g.tat = g.tat.Add(l.emissionInterval() * time.Duration(cost))
+}
+
+// quotaWindow counts the requests of a quota's current calendar period.
+type quotaWindow struct {
+	period Period
+	start  time.Time
+	count  int
+}
+
+func (q *quotaWindow) usage(l limit, now time.Time, cost int) usage {
+	start, end := q.period.window(now)
+	if !start.Equal(q.start) {
+		q.start, q.count = start, 0
+	}
+
+	u := usage{limit: l.requests, remaining: max(0, l.requests-q.count)}
+	if q.count > 0 {
+		u.reset = end.Sub(now)
+	}
+	if q.count+cost > l.requests {
+		u.retryAfter = end.Sub(now)
+	}
+
+	return u
+}
+
+func (q *quotaWindow) consume(_ limit, _ time.Time, cost int) {
+	q.count += cost
+}
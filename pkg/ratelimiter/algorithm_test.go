@@ -0,0 +1,149 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// algorithmTests lists how many of 10 requests every algorithm admits with a
+// limit of 5 requests per second: at once, 200ms later, and 3s later.
+var algorithmTests = []struct {
+	algorithm string
+	initial   int
+	partial   int
+	recovered int
+}{
+	{AlgorithmTokenBucket, 5, 1, 5},
+	{AlgorithmSlidingWindowLog, 5, 0, 5},
+	{AlgorithmSlidingWindowCounter, 5, 0, 5},
+	{AlgorithmGCRA, 5, 1, 5},
+}
+
+func TestAlgorithms(t *testing.T) {
+	l := newLimit(5, 0, time.Second)
+
+	for _, tc := range algorithmTests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			st := newStateFunc(tc.algorithm)(l, testNow)
+
+			admit := func(now time.Time) int {
+				admitted := 0
+				for i := 0; i < 10; i++ {
+					if decide(now, 1, bucket{state: st, limit: l}).Allowed {
+						admitted++
+					}
+				}
+				return admitted
+			}
+
+			assert.Equal(t, tc.initial, admit(testNow))
+			assert.Equal(t, tc.partial, admit(testNow.Add(200*time.Millisecond)))
+			assert.Equal(t, tc.recovered, admit(testNow.Add(3*time.Second)))
+		})
+	}
+}
+
+func TestSlidingWindowCounterWeightsPreviousWindow(t *testing.T) {
+	l := newLimit(5, 0, time.Second)
+	st := newStateFunc(AlgorithmSlidingWindowCounter)(l, testNow)
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, decide(testNow, 1, bucket{state: st, limit: l}).Allowed)
+	}
+
+	// 40% into the next window the previous window still counts for 60%: 3 requests
+	now := testNow.Add(1400 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		assert.True(t, decide(now, 1, bucket{state: st, limit: l}).Allowed)
+	}
+
+	// The next request fits once the previous window counts for 40%: 2 requests
+	d := decide(now, 1, bucket{state: st, limit: l})
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 200*time.Millisecond, d.RetryAfter.Round(time.Millisecond))
+}
+
+// decisionTests lists the decision of a request with a limit of 5 requests
+// per second, 100ms after a burst of five requests.
+var decisionTests = []struct {
+	algorithm  string
+	retryAfter time.Duration
+	reset      time.Duration
+}{
+	{AlgorithmTokenBucket, 100 * time.Millisecond, 900 * time.Millisecond},
+	{AlgorithmSlidingWindowLog, 900 * time.Millisecond, 900 * time.Millisecond},
+	{AlgorithmSlidingWindowCounter, 1100 * time.Millisecond, 1900 * time.Millisecond},
+	{AlgorithmGCRA, 100 * time.Millisecond, 900 * time.Millisecond},
+}
+
+func TestDecisions(t *testing.T) {
+	l := newLimit(5, 0, time.Second)
+
+	for _, tc := range decisionTests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			st := newStateFunc(tc.algorithm)(l, testNow)
+
+			for i := 0; i < 5; i++ {
+				d := decide(testNow, 1, bucket{state: st, limit: l})
+				assert.True(t, d.Allowed)
+				assert.Equal(t, 5, d.Limit)
+				assert.Equal(t, 4-i, d.Remaining)
+			}
+
+			d := decide(testNow.Add(100*time.Millisecond), 1, bucket{state: st, limit: l})
+			assert.False(t, d.Allowed)
+			assert.Equal(t, 0, d.Remaining)
+			assert.Equal(t, tc.retryAfter, d.RetryAfter.Round(time.Millisecond))
+			assert.Equal(t, tc.reset, d.Reset.Round(time.Millisecond))
+		})
+	}
+}
+
+// costTests lists requests of several costs with a limit of 5 requests per
+// second, which every algorithm decides alike.
+var costTests = []struct {
+	cost      int
+	allowed   bool
+	remaining int
+}{
+	{2, true, 3},
+	{2, true, 1},
+	{2, false, 1},
+	{1, true, 0},
+	{6, false, 0},
+}
+
+// costRetryAfters lists how long every algorithm makes the rejected request
+// of costTests wait, with a single request remaining. Requests costing more
+// than the limit are never admitted, and have no time to wait.
+var costRetryAfters = map[string]time.Duration{
+	AlgorithmTokenBucket:          200 * time.Millisecond,
+	AlgorithmSlidingWindowLog:     time.Second,
+	AlgorithmSlidingWindowCounter: 1250 * time.Millisecond,
+	AlgorithmGCRA:                 200 * time.Millisecond,
+}
+
+func TestCosts(t *testing.T) {
+	l := newLimit(5, 0, time.Second)
+
+	for _, tc := range algorithmTests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			st := newStateFunc(tc.algorithm)(l, testNow)
+
+			for _, ct := range costTests {
+				d := decide(testNow, ct.cost, bucket{state: st, limit: l})
+				assert.Equal(t, ct.allowed, d.Allowed, "cost %d", ct.cost)
+				assert.Equal(t, ct.remaining, d.Remaining, "cost %d", ct.cost)
+				assert.Equal(t, ct.cost > l.burst, d.CostExceedsLimit, "cost %d", ct.cost)
+				switch {
+				case ct.allowed, ct.cost > l.burst:
+					assert.Zero(t, d.RetryAfter, "cost %d", ct.cost)
+				default:
+					assert.Equal(t, costRetryAfters[tc.algorithm], d.RetryAfter.Round(time.Millisecond), "cost %d", ct.cost)
+				}
+			}
+		})
+	}
+}
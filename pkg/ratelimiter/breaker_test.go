@@ -0,0 +1,46 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	var states []breakerState
+	b := newBreaker(3, time.Second, func(s breakerState) { states = append(states, s) })
+	b.now = func() time.Time { return now }
+
+	// Failures below the threshold keep the breaker closed, a success resets them
+	b.failure()
+	b.failure()
+	b.success()
+	b.failure()
+	b.failure()
+	assert.True(t, b.allow())
+	assert.Equal(t, breakerClosed, b.state)
+
+	b.failure()
+	assert.Equal(t, breakerOpen, b.state)
+	assert.False(t, b.allow())
+	assert.Equal(t, time.Second, b.retryAfter())
+
+	// Once the cooldown is over a single trial call goes through
+	now = now.Add(time.Second)
+	assert.True(t, b.allow())
+	assert.False(t, b.allow())
+
+	// A failed trial opens the breaker again
+	b.failure()
+	assert.Equal(t, breakerOpen, b.state)
+
+	now = now.Add(time.Second)
+	assert.True(t, b.allow())
+	b.success()
+	assert.Equal(t, breakerClosed, b.state)
+	assert.True(t, b.allow())
+
+	assert.Equal(t, []breakerState{breakerOpen, breakerHalfOpen, breakerOpen, breakerHalfOpen, breakerClosed}, states)
+}
@@ -0,0 +1,84 @@
+package ratelimiter
+
+import (
+	"time"
+)
+
+// Decision is the outcome of a rate limiting check. When a request is
+// subject to several limits, it describes the most restrictive one. The
+// global limit shared by all clients is only described when it rejects the request.
+type Decision struct {
+	// Allowed reports whether the request was admitted.
+	Allowed bool
+	// Limit is the maximum number of requests the client may have available.
+	Limit int
+	// Remaining is the number of requests still available to the client.
+	Remaining int
+	// Reset is the time until all requests are available again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is admitted, zero if Allowed.
+	RetryAfter time.Duration
+	// CostExceedsLimit reports a request costing more than Limit, which is never
+	// admitted however long it waits. RetryAfter is then zero.
+	CostExceedsLimit bool
+}
+
+// bucket pairs a key's state with its limit.
+type bucket struct {
+	state  state
+	limit  limit
+	shared bool
+}
+
+// decide admits a request of cost requests if every bucket allows it and only then charges them.
+func decide(now time.Time, cost int, buckets ...bucket) Decision {
+	var denied, exceeded *usage
+	for _, b := range buckets {
+		u := b.state.usage(b.limit, now, cost)
+		if cost > u.limit && (exceeded == nil || u.limit < exceeded.limit) {
+			exceeded = &u
+		}
+		if u.retryAfter > 0 && (denied == nil || u.retryAfter > denied.retryAfter) {
+			denied = &u
+		}
+	}
+
+	if exceeded != nil {
+		d := exceeded.decision(false)
+		d.RetryAfter, d.CostExceedsLimit = 0, true
+		return d
+	}
+	if denied != nil {
+		return denied.decision(false)
+	}
+
+	var tightest *usage
+	for _, b := range buckets {
+		b.state.consume(b.limit, now, cost)
+
+		u := b.state.usage(b.limit, now, cost)
+		if !b.shared && (tightest == nil || u.remaining < tightest.remaining) {
+			tightest = &u
+		}
+	}
+
+	if tightest == nil {
+		return Decision{Allowed: true}
+	}
+
+	return tightest.decision(true)
+}
+
+func (u usage) decision(allowed bool) Decision {
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     u.limit,
+		Remaining: u.remaining,
+		Reset:     u.reset,
+	}
+	if !allowed {
+		d.RetryAfter = u.retryAfter
+	}
+
+	return d
+}
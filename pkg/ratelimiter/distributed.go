@@ -2,6 +2,11 @@ package ratelimiter
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,67 +18,392 @@ import (
 const (
 	global               = "global"
 	rateLimiterKeyPrefix = "rate_limiter:"
+	// limitsKey holds the limits changed at runtime, shared by the replicas.
+	limitsKey = "settings:limits"
+	// limitsRefreshInterval is how often replicas read the limits changed at runtime.
+	limitsRefreshInterval = time.Second
+	// scanCount is the number of keys scanned per round trip.
+	scanCount = 1000
+)
+
+// errBreakerOpen is returned for calls rejected by the open circuit breaker.
+var errBreakerOpen = errors.New("circuit breaker open")
+
+// Failure policies accepted by config.RateLimiter.OnFailure.
+const (
+	// FailOpen admits requests while Redis is unavailable.
+	FailOpen = "open"
+	// FailClosed rejects requests while Redis is unavailable.
+	FailClosed = "closed"
+	// FailLocal rate limits requests in memory while Redis is unavailable.
+	FailLocal = "local"
 )
 
 type DistributedRateLimiter struct {
-	log                  logger.Interface
-	client               *redis.Client
-	globalBucketCapacity int
-	bucketCapacity       int
-	interval             time.Duration
+	log       logger.Interface
+	client    redis.UniversalClient
+	keyPrefix string
+	script    *redis.Script
+	inspect   *redis.Script
+	limits    *limits
+	// now places quotas in their calendar period; buckets use the Redis clock
+	now       func() time.Time
+	breaker   *breaker
+	policy    string
+	fallback  *LocalRateLimiter
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 }
 
-func NewDistributedRateLimiter(cfg config.RateLimiter, l logger.Interface) *DistributedRateLimiter {
-	client := redis.NewClient(&redis.Options{
-		Addr: cfg.RedisAddr,
-	})
+// NewDistributedRateLimiter returns a limiter backed by Redis. It starts in
+// degraded mode, deciding requests with the failure policy, when Redis is
+// unavailable. The limits changed at runtime by any replica are stored in
+// Redis, and take precedence over those of cfg.
+func NewDistributedRateLimiter(cfg config.RateLimiter, l logger.Interface) (*DistributedRateLimiter, error) {
+	client, err := newRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	rl := &DistributedRateLimiter{
+		log:       l,
+		client:    client,
+		keyPrefix: keyPrefix(cfg.RedisMode),
+		script:    newScript(cfg.Algorithm),
+		inspect:   newInspectScript(cfg.Algorithm),
+		limits:    newLimits(cfg),
+		now:       time.Now,
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, func(state breakerState) {
+			breakerStateGauge.Set(float64(state))
+		}),
+		policy: cfg.OnFailure,
+		done:   make(chan struct{}),
+	}
+
+	if rl.policy == FailLocal {
+		// Only the local limiter persists its buckets, the fallback's are short-lived
+		fallbackCfg := cfg
+		fallbackCfg.SnapshotFile = ""
+		rl.fallback = NewLocalRateLimiter(fallbackCfg, l)
+		// Limits changed at runtime apply to the fallback as well
+		rl.fallback.limits = rl.limits
+	}
 
 	if err := client.Ping(context.Background()).Err(); err != nil {
-		l.Fatal("Failed to connect to Redis: %v", err)
+		redisErrors.Inc()
+		rl.breaker.failure()
+		l.Error(fmt.Errorf("ratelimiter - NewDistributedRateLimiter - starting in degraded mode: %w", err))
+	} else if err := rl.refreshLimits(context.Background()); err != nil {
+		l.Error(err)
+	}
+
+	rl.wg.Add(1)
+	go rl.watchLimits()
+
+	return rl, nil
+}
+
+func (rl *DistributedRateLimiter) Allow(ctx context.Context, req Request) Decision {
+	decision, err := rl.call(ctx, req, req.cost(), false)
+	if err != nil && ctx.Err() == nil {
+		return rl.onFailure(ctx, req)
+	}
+
+	return decision
+}
+
+// Close stops the fallback limiter and closes the connections to Redis.
+func (rl *DistributedRateLimiter) Close() {
+	rl.closeOnce.Do(func() {
+		close(rl.done)
+		rl.wg.Wait()
+		if rl.fallback != nil {
+			rl.fallback.Close()
+		}
+		if err := rl.client.Close(); err != nil {
+			rl.log.Error(fmt.Errorf("ratelimiter - DistributedRateLimiter - Close: %w", err))
+		}
+	})
+}
+
+// Ping checks that Redis is reachable.
+func (rl *DistributedRateLimiter) Ping(ctx context.Context) error {
+	if err := rl.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("ratelimiter - DistributedRateLimiter - Ping: %w", err)
 	}
 
-	return &DistributedRateLimiter{
-		log:                  l,
-		client:               client,
-		globalBucketCapacity: cfg.MaxRequests,
-		bucketCapacity:       cfg.UserRequests,
-		interval:             cfg.Interval,
+	return nil
+}
+
+// call charges cost requests to the request's keys in Redis, through the
+// circuit breaker. Forced calls charge the keys even if they reject the request.
+func (rl *DistributedRateLimiter) call(ctx context.Context, req Request, cost int, force bool) (Decision, error) {
+	if !rl.breaker.allow() {
+		return Decision{}, errBreakerOpen
+	}
+
+	decision, err := rl.eval(ctx, req, cost, force)
+	switch {
+	case err == nil:
+		rl.breaker.success()
+	case ctx.Err() != nil:
+		// The request was canceled, Redis is not to blame
+		rl.breaker.abort()
+	default:
+		redisErrors.Inc()
+		rl.breaker.failure()
+		rl.log.Error(fmt.Errorf("ratelimiter - DistributedRateLimiter - call: %w", err))
 	}
+
+	return decision, err
 }
-func (rl *DistributedRateLimiter) Allow(ctx context.Context, clientIP string) bool {
-	globalKey := rateLimiterKeyPrefix + global
-	clientKey := rateLimiterKeyPrefix + clientIP
+
+// onFailure decides the request with the failure policy.
+func (rl *DistributedRateLimiter) onFailure(ctx context.Context, req Request) Decision {
+	fallbackDecisions.WithLabelValues(rl.policy).Inc()
+
+	clientLimit := rl.limits.client()
+	if req.Limit != nil {
+		clientLimit = req.Limit.limit()
+	}
+
+	switch rl.policy {
+	case FailOpen:
+		return Decision{Allowed: true, Limit: clientLimit.burst, Remaining: clientLimit.burst}
+	case FailLocal:
+		return rl.fallback.Allow(ctx, req)
+	default:
+		return Decision{Limit: clientLimit.burst, RetryAfter: max(time.Second, rl.breaker.retryAfter())}
+	}
+}
+
+func (rl *DistributedRateLimiter) eval(ctx context.Context, req Request, cost int, force bool) (Decision, error) {
+	globalKey := rl.keyPrefix + global
+	clientKey := rl.keyPrefix + req.Key
 
 	rl.log.Debug("Rate limiting keys: global=%s, client=%s", globalKey, clientKey)
 
-	// Increment global bucket
-	globalCurrent, err := rl.client.Incr(ctx, globalKey).Result()
+	clientLimit := rl.limits.client()
+	if req.Limit != nil {
+		clientLimit = req.Limit.limit()
+	}
+
+	globalLimit := rl.limits.global()
+	keys := []string{globalKey, clientKey}
+	args := []interface{}{
+		cost, 2 + len(req.Keys), force,
+		globalLimit.requests, globalLimit.burst, globalLimit.interval.Milliseconds(),
+		clientLimit.requests, clientLimit.burst, clientLimit.interval.Milliseconds(),
+	}
+
+	for _, k := range req.Keys {
+		l := k.Limit.limitOr(rl.limits.client())
+		keys = append(keys, rl.keyPrefix+k.Key)
+		args = append(args, l.requests, l.burst, l.interval.Milliseconds())
+	}
+
+	now := rl.now()
+	for _, q := range req.Quotas {
+		start, end := q.Period.window(now)
+		keys = append(keys, rl.keyPrefix+q.key(req.Key))
+		args = append(args, q.Requests, start.UnixMilli(), end.UnixMilli())
+	}
+
+	result, err := rl.script.Run(ctx, rl.client, keys, args...).Int64Slice()
 	if err != nil {
-		return false
+		return Decision{}, err
+	}
+
+	return Decision{
+		Allowed:          result[0] == 1,
+		Limit:            int(result[1]),
+		Remaining:        int(result[2]),
+		Reset:            time.Duration(result[3]) * time.Millisecond,
+		RetryAfter:       time.Duration(result[4]) * time.Millisecond,
+		CostExceedsLimit: result[5] == 1,
+	}, nil
+}
+
+// Inspect returns the state of key's bucket in Redis, or of the global bucket
+// for "global". Redis doesn't record the limits of keys, so client keys are
+// reported against the per client limit, even those limited otherwise, e.g.
+// by the tier of their API key.
+func (rl *DistributedRateLimiter) Inspect(ctx context.Context, key string) (KeyState, error) {
+	if isQuotaKey(key) || key == limitsKey {
+		return KeyState{}, ErrNotFound
 	}
 
-	// If the global bucket is empty, set the expiration time
-	if globalCurrent == 1 {
-		_, err = rl.client.Expire(ctx, globalKey, rl.interval).Result()
-		if err != nil {
-			return false
+	l := rl.limits.client()
+	if key == global {
+		l = rl.limits.global()
+	}
+
+	keys := []string{rl.keyPrefix + key}
+	result, err := rl.inspect.Run(ctx, rl.client, keys, 0, 1, false, l.requests, l.burst, l.interval.Milliseconds()).Int64Slice()
+	if err != nil {
+		return KeyState{}, fmt.Errorf("ratelimiter - DistributedRateLimiter - Inspect: %w", err)
+	}
+	if result[0] == 0 {
+		return KeyState{}, ErrNotFound
+	}
+
+	s := KeyState{
+		Key:       key,
+		Limit:     int(result[1]),
+		Remaining: int(result[2]),
+		Reset:     time.Duration(result[3]) * time.Millisecond,
+		TTL:       time.Duration(result[5]) * time.Millisecond,
+	}
+	if result[4] > 0 {
+		s.LastRefill = time.UnixMilli(result[4])
+	}
+
+	return s, nil
+}
+
+// TopConsumers returns the n keys that used the most of their limit. It scans
+// every key of the limiter, and is meant for troubleshooting rather than for
+// frequent use.
+func (rl *DistributedRateLimiter) TopConsumers(ctx context.Context, n int) ([]KeyState, error) {
+	keys, err := rl.scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimiter - DistributedRateLimiter - TopConsumers: %w", err)
+	}
+
+	states := make([]KeyState, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimPrefix(key, rl.keyPrefix)
+		if key == global || isQuotaKey(key) || key == limitsKey {
+			continue
 		}
+
+		s, err := rl.Inspect(ctx, key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			// The key expired since the scan
+			continue
+		case err != nil:
+			return nil, err
+		}
+		states = append(states, s)
+	}
+
+	return topConsumers(states, n), nil
+}
+
+// Reset deletes the bucket of key, so that its next request starts afresh.
+// Resetting "global" refills the global bucket.
+func (rl *DistributedRateLimiter) Reset(ctx context.Context, key string) error {
+	if key == limitsKey {
+		return ErrNotFound
 	}
 
-	// Increment client bucket
-	clientCurrent, err := rl.client.Incr(ctx, clientKey).Result()
+	deleted, err := rl.client.Del(ctx, rl.keyPrefix+key).Result()
 	if err != nil {
-		return false
+		return fmt.Errorf("ratelimiter - DistributedRateLimiter - Reset: %w", err)
 	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
 
-	// If the client bucket is empty, set the expiration time
-	if clientCurrent == 1 {
-		_, err = rl.client.Expire(ctx, clientKey, rl.interval).Result()
-		if err != nil {
-			return false
+// Limits returns the current global and per client limits.
+func (rl *DistributedRateLimiter) Limits() Limits {
+	return rl.limits.get()
+}
+
+// SetLimits replaces the global and per client limits of every replica. They
+// are stored in Redis, which the other replicas read them from within a
+// second. Redis keeps the buckets' state, and holds them to the limits of
+// their next request.
+func (rl *DistributedRateLimiter) SetLimits(ctx context.Context, l Limits) error {
+	err := rl.client.HSet(ctx, rl.keyPrefix+limitsKey,
+		"maxRequests", l.MaxRequests,
+		"userRequests", l.UserRequests,
+		"interval", l.Interval.Milliseconds(),
+	).Err()
+	if err != nil {
+		return fmt.Errorf("ratelimiter - DistributedRateLimiter - SetLimits: %w", err)
+	}
+	rl.limits.set(l)
+
+	return nil
+}
+
+func (rl *DistributedRateLimiter) watchLimits() {
+	defer rl.wg.Done()
+
+	ticker := time.NewTicker(limitsRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.done:
+			return
+		case <-ticker.C:
+			if !rl.breaker.allow() {
+				// Redis is down, the limits are read again once it is back
+				continue
+			}
+			if err := rl.refreshLimits(context.Background()); err != nil {
+				rl.log.Warn(err.Error())
+			}
+		}
+	}
+}
+
+// refreshLimits reads the limits changed at runtime from Redis, if any.
+func (rl *DistributedRateLimiter) refreshLimits(ctx context.Context) error {
+	fields, err := rl.client.HGetAll(ctx, rl.keyPrefix+limitsKey).Result()
+	if err != nil {
+		return fmt.Errorf("ratelimiter - DistributedRateLimiter - refreshLimits: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	maxRequests, err1 := strconv.Atoi(fields["maxRequests"])
+	userRequests, err2 := strconv.Atoi(fields["userRequests"])
+	interval, err3 := strconv.ParseInt(fields["interval"], 10, 64)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return fmt.Errorf("ratelimiter - DistributedRateLimiter - refreshLimits: %w", err)
+	}
+	if maxRequests <= 0 || userRequests <= 0 || interval <= 0 {
+		return fmt.Errorf("ratelimiter - DistributedRateLimiter - refreshLimits: invalid limits %v", fields)
+	}
+
+	rl.limits.set(Limits{MaxRequests: maxRequests, UserRequests: userRequests, Interval: time.Duration(interval) * time.Millisecond})
+
+	return nil
+}
+
+// scan returns the Redis keys of the limiter, from every master in cluster mode.
+func (rl *DistributedRateLimiter) scan(ctx context.Context) ([]string, error) {
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+
+	scanNode := func(ctx context.Context, c redis.Cmdable) error {
+		iter := c.Scan(ctx, 0, rl.keyPrefix+"*", scanCount).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			keys = append(keys, iter.Val())
+			mu.Unlock()
 		}
+
+		return iter.Err()
+	}
+
+	if cluster, ok := rl.client.(*redis.ClusterClient); ok {
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+			return scanNode(ctx, c)
+		})
+		return keys, err
 	}
 
-	// Check if both global and client limits are within the allowed capacity
-	return globalCurrent <= int64(rl.globalBucketCapacity) && clientCurrent <= int64(rl.bucketCapacity)
+	return keys, scanNode(ctx, rl.client)
 }
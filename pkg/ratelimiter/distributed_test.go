@@ -0,0 +1,306 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+var testNow = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestDistributedRateLimiter(t *testing.T, cfg config.RateLimiter) (*DistributedRateLimiter, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	mr.SetTime(testNow)
+	cfg.RedisAddr = mr.Addr()
+
+	rl, err := NewDistributedRateLimiter(cfg, logger.New("debug"))
+	assert.NoError(t, err)
+	// Follow the miniredis clock
+	rl.now = func() time.Time { return rl.client.Time(context.Background()).Val() }
+	t.Cleanup(rl.Close)
+
+	return rl, mr
+}
+
+func TestDistributedRateLimiter(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:  10,
+		UserRequests: 5,
+		Interval:     time.Second,
+	}
+	rl, mr := newTestDistributedRateLimiter(t, cfg)
+
+	clientIP := "192.168.1.1"
+
+	// Test allowing requests within the limit
+	for i := 0; i < 5; i++ {
+		assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be allowed")
+	}
+
+	// Test exceeding the limit
+	assert.False(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be denied")
+
+	// Tokens refill continuously: one token every 200ms
+	mr.SetTime(testNow.Add(200 * time.Millisecond))
+	assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be allowed after partial refill")
+	assert.False(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be denied")
+
+	// Buckets expire once they would be full again
+	clientKey := rateLimiterKeyPrefix + clientIP
+	assert.True(t, mr.Exists(clientKey))
+	assert.LessOrEqual(t, mr.TTL(clientKey), time.Second+time.Millisecond)
+}
+
+func TestDistributedGlobalRateLimiter(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:  10,
+		UserRequests: 5,
+		Interval:     time.Second,
+	}
+	rl, _ := newTestDistributedRateLimiter(t, cfg)
+
+	clientIP1 := "192.168.1.1"
+	clientIP2 := "192.168.1.2"
+	clientIP3 := "192.168.1.3"
+
+	// A client over its own limit must not drain the global bucket
+	for i := 0; i < 5; i++ {
+		assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP1}).Allowed, "Request should be allowed for clientIP1")
+	}
+	for i := 0; i < 10; i++ {
+		assert.False(t, rl.Allow(context.Background(), Request{Key: clientIP1}).Allowed, "Request should be denied for clientIP1")
+	}
+
+	// Test allowing requests within the global limit
+	for i := 0; i < 5; i++ {
+		assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP2}).Allowed, "Request should be allowed for clientIP2")
+	}
+
+	// Test exceeding the global limit
+	assert.False(t, rl.Allow(context.Background(), Request{Key: clientIP3}).Allowed, "Request should be denied for clientIP3")
+}
+
+func TestDistributedAlgorithms(t *testing.T) {
+	for _, tc := range algorithmTests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			cfg := config.RateLimiter{
+				Algorithm:    tc.algorithm,
+				MaxRequests:  100,
+				UserRequests: 5,
+				Interval:     time.Second,
+			}
+			rl, mr := newTestDistributedRateLimiter(t, cfg)
+
+			admit := func(now time.Time) int {
+				mr.SetTime(now)
+				admitted := 0
+				for i := 0; i < 10; i++ {
+					if rl.Allow(context.Background(), Request{Key: "192.168.1.1"}).Allowed {
+						admitted++
+					}
+				}
+				return admitted
+			}
+
+			assert.Equal(t, tc.initial, admit(testNow))
+			assert.Equal(t, tc.partial, admit(testNow.Add(200*time.Millisecond)))
+			mr.FastForward(3 * time.Second)
+			assert.Equal(t, tc.recovered, admit(testNow.Add(3*time.Second)))
+		})
+	}
+}
+
+func TestDistributedDecisions(t *testing.T) {
+	for _, tc := range decisionTests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			cfg := config.RateLimiter{
+				Algorithm:    tc.algorithm,
+				MaxRequests:  100,
+				UserRequests: 5,
+				Interval:     time.Second,
+			}
+			rl, mr := newTestDistributedRateLimiter(t, cfg)
+
+			for i := 0; i < 5; i++ {
+				d := rl.Allow(context.Background(), Request{Key: "192.168.1.1"})
+				assert.True(t, d.Allowed)
+				assert.Equal(t, 5, d.Limit)
+				assert.Equal(t, 4-i, d.Remaining)
+			}
+
+			mr.SetTime(testNow.Add(100 * time.Millisecond))
+			d := rl.Allow(context.Background(), Request{Key: "192.168.1.1"})
+			assert.False(t, d.Allowed)
+			assert.Equal(t, 0, d.Remaining)
+			assert.Equal(t, tc.retryAfter, d.RetryAfter)
+			assert.Equal(t, tc.reset, d.Reset)
+		})
+	}
+}
+
+func TestDistributedRateLimiterQuota(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:  100,
+		UserRequests: 5,
+		Interval:     time.Second,
+	}
+	rl, mr := newTestDistributedRateLimiter(t, cfg)
+	mr.SetTime(testNow.Add(12 * time.Hour))
+
+	req := Request{
+		Key:    "key:partner",
+		Limit:  &Limit{Requests: 50, Interval: time.Second},
+		Quotas: []Quota{{Period: Daily, Requests: 20}, {Period: Monthly, Requests: 1000}},
+	}
+
+	for i := 0; i < 20; i++ {
+		assert.True(t, rl.Allow(context.Background(), req).Allowed, "Request should be allowed")
+	}
+
+	// The daily quota is exhausted until midnight
+	d := rl.Allow(context.Background(), req)
+	assert.False(t, d.Allowed, "Request should be denied")
+	assert.Equal(t, 20, d.Limit)
+	assert.Equal(t, 12*time.Hour, d.RetryAfter)
+
+	mr.SetTime(testNow.Add(24 * time.Hour))
+	assert.True(t, rl.Allow(context.Background(), req).Allowed, "Request should be allowed the next day")
+}
+
+func TestDistributedRateLimiterOnFailure(t *testing.T) {
+	tests := []struct {
+		policy  string
+		allowed []bool
+	}{
+		{policy: FailOpen, allowed: []bool{true, true, true}},
+		{policy: FailClosed, allowed: []bool{false, false, false}},
+		{policy: FailLocal, allowed: []bool{true, true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			cfg := config.RateLimiter{
+				MaxRequests:      10,
+				UserRequests:     2,
+				Interval:         time.Minute,
+				BucketTTL:        time.Minute,
+				CleanInterval:    time.Minute,
+				OnFailure:        tt.policy,
+				BreakerThreshold: 5,
+				BreakerCooldown:  time.Second,
+			}
+			rl, mr := newTestDistributedRateLimiter(t, cfg)
+			mr.SetError("ERR connection lost")
+
+			for i, allowed := range tt.allowed {
+				d := rl.Allow(context.Background(), Request{Key: "192.168.1.1"})
+				assert.Equal(t, allowed, d.Allowed, "request %d", i)
+				assert.Equal(t, 2, d.Limit)
+				if !allowed {
+					assert.Positive(t, d.RetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestDistributedRateLimiterBreaker(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:      10,
+		UserRequests:     5,
+		Interval:         time.Second,
+		OnFailure:        FailOpen,
+		BreakerThreshold: 2,
+		BreakerCooldown:  10 * time.Second,
+	}
+	rl, mr := newTestDistributedRateLimiter(t, cfg)
+
+	now := testNow
+	rl.breaker.now = func() time.Time { return now }
+
+	// The breaker opens after two consecutive failures
+	mr.SetError("ERR connection lost")
+	rl.Allow(context.Background(), Request{Key: "192.168.1.1"})
+	rl.Allow(context.Background(), Request{Key: "192.168.1.1"})
+	assert.Equal(t, breakerOpen, rl.breaker.state)
+
+	// While open, Redis is not called at all
+	commands := mr.CommandCount()
+	assert.True(t, rl.Allow(context.Background(), Request{Key: "192.168.1.1"}).Allowed)
+	assert.Equal(t, commands, mr.CommandCount())
+
+	// After the cooldown a trial call closes the breaker again
+	mr.SetError("")
+	now = now.Add(10 * time.Second)
+	assert.True(t, rl.Allow(context.Background(), Request{Key: "192.168.1.1"}).Allowed)
+	assert.Equal(t, breakerClosed, rl.breaker.state)
+	assert.Greater(t, mr.CommandCount(), commands)
+}
+
+func TestDistributedRateLimiterDegradedStartup(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	cfg := config.RateLimiter{
+		MaxRequests:      10,
+		UserRequests:     5,
+		Interval:         time.Second,
+		RedisAddr:        addr,
+		OnFailure:        FailClosed,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Minute,
+	}
+	rl, err := NewDistributedRateLimiter(cfg, logger.New("debug"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, breakerOpen, rl.breaker.state)
+	d := rl.Allow(context.Background(), Request{Key: "192.168.1.1"})
+	assert.False(t, d.Allowed)
+	assert.Greater(t, d.RetryAfter, 59*time.Second)
+}
+
+func TestDistributedCosts(t *testing.T) {
+	for _, tc := range algorithmTests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			cfg := config.RateLimiter{
+				Algorithm:    tc.algorithm,
+				MaxRequests:  100,
+				UserRequests: 5,
+				Interval:     time.Second,
+			}
+			rl, _ := newTestDistributedRateLimiter(t, cfg)
+
+			for _, ct := range costTests {
+				d := rl.Allow(context.Background(), Request{Key: "192.168.1.1", Cost: ct.cost})
+				assert.Equal(t, ct.allowed, d.Allowed, "cost %d", ct.cost)
+				assert.Equal(t, ct.remaining, d.Remaining, "cost %d", ct.cost)
+				assert.Equal(t, ct.cost > cfg.UserRequests, d.CostExceedsLimit, "cost %d", ct.cost)
+				switch {
+				case ct.allowed, ct.cost > cfg.UserRequests:
+					assert.Zero(t, d.RetryAfter, "cost %d", ct.cost)
+				default:
+					assert.Equal(t, costRetryAfters[tc.algorithm], d.RetryAfter, "cost %d", ct.cost)
+				}
+			}
+		})
+	}
+}
+
+func TestDistributedRateLimiterPing(t *testing.T) {
+	rl, mr := newTestDistributedRateLimiter(t, config.RateLimiter{MaxRequests: 10, UserRequests: 5, Interval: time.Second})
+	defer rl.Close()
+
+	assert.NoError(t, rl.Ping(context.Background()))
+
+	mr.Close()
+	assert.Error(t, rl.Ping(context.Background()))
+}
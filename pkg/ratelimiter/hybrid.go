@@ -0,0 +1,277 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+// HybridRateLimiter spends leases of Redis tokens locally. The first request
+// of a key is decided by Redis, and leaves the replica a lease of up to
+// leaseSize requests that it admits without a round trip. Locally admitted
+// requests are charged to Redis in the background every sync interval, which
+// also renews the lease of busy keys from Redis' current view. Since replicas
+// do not see each other's unsynced requests, a key may be over-admitted by up
+// to leaseSize requests per replica. The replica leases the global key too:
+// it admits at most leaseSize requests across all its keys before Redis
+// charges them, so that the global limit is over-admitted by up to leaseSize
+// requests per replica as well.
+type HybridRateLimiter struct {
+	log          logger.Interface
+	remote       *DistributedRateLimiter
+	leaseSize    int
+	syncInterval time.Duration
+	mu           sync.Mutex
+	leases       map[string]*lease
+	// unsynced is the number of requests admitted under leases, across keys, that Redis hasn't charged yet
+	unsynced  int
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// lease is a replica's allowance for a key.
+type lease struct {
+	// req carries the key's limits, to charge them when syncing
+	req Request
+	// decision is Redis' view of the key as of the last call
+	decision Decision
+	// tokens is the number of requests still admissible locally
+	tokens int
+	// pending is the number of locally admitted requests not yet charged to Redis
+	pending int
+	// syncing is the number of requests being charged to Redis
+	syncing int
+}
+
+func NewHybridRateLimiter(cfg config.RateLimiter, l logger.Interface) (*HybridRateLimiter, error) {
+	remote, err := NewDistributedRateLimiter(cfg, l)
+	if err != nil {
+		return nil, err
+	}
+
+	rl := &HybridRateLimiter{
+		log:          l,
+		remote:       remote,
+		leaseSize:    cfg.LeaseSize,
+		syncInterval: cfg.SyncInterval,
+		leases:       make(map[string]*lease),
+		done:         make(chan struct{}),
+	}
+
+	rl.wg.Add(1)
+	go rl.syncLeases(cfg.SyncInterval)
+
+	return rl, nil
+}
+
+func (rl *HybridRateLimiter) Allow(ctx context.Context, req Request) Decision {
+	rl.mu.Lock()
+	l, ok := rl.leases[req.Key]
+	if !ok {
+		l = &lease{req: req}
+		rl.leases[req.Key] = l
+	}
+	if l.tokens >= req.cost() && rl.unsynced+req.cost() <= rl.leaseSize {
+		l.tokens -= req.cost()
+		l.pending += req.cost()
+		rl.unsynced += req.cost()
+		decision := l.remaining()
+		rl.mu.Unlock()
+		return decision
+	}
+	// Charge the pending requests along with this one, Redis rejects it if they used up the key
+	pending := l.take()
+	rl.mu.Unlock()
+
+	decision, err := rl.remote.call(ctx, req, req.cost()+pending, false)
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l.req = req
+	l.syncing -= pending
+	if err != nil || !decision.Allowed {
+		rl.uncharged(l, pending)
+	} else {
+		rl.unsynced -= pending
+	}
+
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return decision
+	case err != nil:
+		return rl.remote.onFailure(ctx, req)
+	case decision.CostExceedsLimit && req.cost() <= decision.Limit:
+		// The pending requests it carried did, which are charged by the next sync at the latest
+		decision.CostExceedsLimit = false
+		decision.RetryAfter = max(decision.Reset, rl.syncInterval)
+		return decision
+	case !decision.Allowed:
+		return decision
+	}
+
+	l.renew(decision, rl.leaseSize)
+
+	return l.remaining()
+}
+
+// Close stops syncing, charges the pending requests to Redis and closes the connections to it.
+func (rl *HybridRateLimiter) Close() {
+	rl.closeOnce.Do(func() {
+		close(rl.done)
+		rl.wg.Wait()
+		rl.sync()
+		rl.remote.Close()
+	})
+}
+
+// Ping checks that Redis is reachable.
+func (rl *HybridRateLimiter) Ping(ctx context.Context) error {
+	return rl.remote.Ping(ctx)
+}
+
+func (rl *HybridRateLimiter) syncLeases(interval time.Duration) {
+	defer rl.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.done:
+			return
+		case <-ticker.C:
+			rl.sync()
+		}
+	}
+}
+
+// sync charges the locally admitted requests to Redis and renews the leases
+// with Redis' view. Idle leases are dropped, so that their keys go back to
+// Redis on their next request.
+func (rl *HybridRateLimiter) sync() {
+	type charge struct {
+		lease *lease
+		cost  int
+	}
+
+	rl.mu.Lock()
+	var charges []charge
+	for key, l := range rl.leases {
+		if l.pending == 0 {
+			if l.syncing == 0 {
+				delete(rl.leases, key)
+			}
+			continue
+		}
+		charges = append(charges, charge{lease: l, cost: l.take()})
+	}
+	rl.mu.Unlock()
+
+	for _, c := range charges {
+		decision, err := rl.remote.call(context.Background(), c.lease.req, c.cost, true)
+
+		rl.mu.Lock()
+		c.lease.syncing -= c.cost
+		if err != nil {
+			// Keep the requests for the next sync, and stop admitting locally until Redis is back
+			rl.uncharged(c.lease, c.cost)
+		} else {
+			rl.unsynced -= c.cost
+			c.lease.renew(decision, rl.leaseSize)
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// uncharged returns n requests that Redis didn't charge to the pending
+// requests of l, and stops admitting under l until it is renewed. The requests
+// are dropped if l was reset meanwhile.
+func (rl *HybridRateLimiter) uncharged(l *lease, n int) {
+	if rl.leases[l.req.Key] != l {
+		rl.unsynced -= n
+		return
+	}
+	l.pending += n
+	l.tokens = 0
+}
+
+// take marks the pending requests as being charged to Redis and returns their number.
+func (l *lease) take() int {
+	n := l.pending
+	l.pending = 0
+	l.syncing += n
+
+	return n
+}
+
+// renew records Redis' view of the key. The replica may hold up to size
+// requests that Redis doesn't know about, admitted or still admissible.
+func (l *lease) renew(decision Decision, size int) {
+	l.decision = decision
+	l.tokens = 0
+	if decision.Allowed {
+		l.tokens = max(0, min(size, decision.Remaining)-l.pending)
+	}
+}
+
+// remaining returns the decision of a request admitted under the lease.
+func (l *lease) remaining() Decision {
+	decision := l.decision
+	decision.Allowed = true
+	decision.Remaining = max(0, decision.Remaining-l.pending-l.syncing)
+	decision.RetryAfter = 0
+
+	return decision
+}
+
+// Inspect returns the state of key in Redis, less the requests this replica
+// admitted under its lease that are not charged yet.
+func (rl *HybridRateLimiter) Inspect(ctx context.Context, key string) (KeyState, error) {
+	s, err := rl.remote.Inspect(ctx, key)
+	if err != nil {
+		return KeyState{}, err
+	}
+
+	rl.mu.Lock()
+	if l, ok := rl.leases[key]; ok {
+		s.Remaining = max(0, s.Remaining-l.pending-l.syncing)
+	}
+	rl.mu.Unlock()
+
+	return s, nil
+}
+
+// TopConsumers returns the n keys that used the most of their limit, as charged to Redis.
+func (rl *HybridRateLimiter) TopConsumers(ctx context.Context, n int) ([]KeyState, error) {
+	return rl.remote.TopConsumers(ctx, n)
+}
+
+// Reset drops this replica's lease of key, along with its uncharged requests,
+// and deletes the bucket of key in Redis.
+func (rl *HybridRateLimiter) Reset(ctx context.Context, key string) error {
+	rl.mu.Lock()
+	if l, ok := rl.leases[key]; ok {
+		rl.unsynced -= l.pending
+		delete(rl.leases, key)
+	}
+	rl.mu.Unlock()
+
+	return rl.remote.Reset(ctx, key)
+}
+
+// Limits returns the current global and per client limits.
+func (rl *HybridRateLimiter) Limits() Limits {
+	return rl.remote.Limits()
+}
+
+// SetLimits replaces the global and per client limits of every replica, see
+// DistributedRateLimiter.SetLimits. Leases are held to the new limits once
+// they are renewed.
+func (rl *HybridRateLimiter) SetLimits(ctx context.Context, l Limits) error {
+	return rl.remote.SetLimits(ctx, l)
+}
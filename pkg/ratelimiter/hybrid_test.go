@@ -0,0 +1,176 @@
+package ratelimiter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+// newTestHybridRateLimiter returns a replica on mr that only syncs when told to.
+func newTestHybridRateLimiter(t *testing.T, cfg config.RateLimiter, mr *miniredis.Miniredis) *HybridRateLimiter {
+	t.Helper()
+
+	cfg.RedisAddr = mr.Addr()
+	cfg.SyncInterval = time.Hour
+	cfg.BreakerThreshold = 5
+	cfg.BreakerCooldown = time.Second
+
+	rl, err := NewHybridRateLimiter(cfg, logger.New("debug"))
+	assert.NoError(t, err)
+	// Follow the miniredis clock
+	rl.remote.now = func() time.Time { return rl.remote.client.Time(context.Background()).Val() }
+	t.Cleanup(rl.Close)
+
+	return rl
+}
+
+func TestHybridRateLimiterLeases(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(testNow)
+	cfg := config.RateLimiter{
+		MaxRequests:  1000,
+		UserRequests: 100,
+		Interval:     time.Minute,
+		LeaseSize:    10,
+	}
+	rl := newTestHybridRateLimiter(t, cfg, mr)
+
+	clientIP := "192.168.1.1"
+	clientKey := rateLimiterKeyPrefix + clientIP
+
+	// The first request goes to Redis and takes a lease
+	d := rl.Allow(context.Background(), Request{Key: clientIP})
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 99, d.Remaining)
+
+	// The lease is spent without calling Redis
+	commands := mr.CommandCount()
+	for i := 0; i < 10; i++ {
+		d = rl.Allow(context.Background(), Request{Key: clientIP})
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 98-i, d.Remaining)
+	}
+	assert.Equal(t, commands, mr.CommandCount())
+	assert.Equal(t, "99", mr.HGet(clientKey, "tokens"))
+
+	// Syncing charges the locally admitted requests and renews the lease
+	rl.sync()
+	assert.Equal(t, "89", mr.HGet(clientKey, "tokens"))
+	assert.Equal(t, "989", mr.HGet(rateLimiterKeyPrefix+global, "tokens"))
+
+	commands = mr.CommandCount()
+	d = rl.Allow(context.Background(), Request{Key: clientIP})
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 88, d.Remaining)
+	assert.Equal(t, commands, mr.CommandCount())
+
+	// Idle leases are dropped after being synced
+	rl.sync()
+	rl.sync()
+	assert.Empty(t, rl.leases)
+}
+
+func TestHybridRateLimiterOverAdmission(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(testNow)
+	cfg := config.RateLimiter{
+		MaxRequests:  1000,
+		UserRequests: 10,
+		Interval:     time.Hour,
+		LeaseSize:    3,
+	}
+	replicas := []*HybridRateLimiter{
+		newTestHybridRateLimiter(t, cfg, mr),
+		newTestHybridRateLimiter(t, cfg, mr),
+	}
+
+	admitted := 0
+	for i := 0; i < 20; i++ {
+		for _, rl := range replicas {
+			if rl.Allow(context.Background(), Request{Key: "192.168.1.1"}).Allowed {
+				admitted++
+			}
+		}
+	}
+
+	// Each replica admits at most a lease of requests that Redis doesn't know about
+	assert.GreaterOrEqual(t, admitted, 10)
+	assert.LessOrEqual(t, admitted, 10+len(replicas)*cfg.LeaseSize)
+
+	for _, rl := range replicas {
+		rl.sync()
+		assert.False(t, rl.Allow(context.Background(), Request{Key: "192.168.1.1"}).Allowed)
+	}
+	assert.Equal(t, strconv.Itoa(10-admitted), mr.HGet(rateLimiterKeyPrefix+"192.168.1.1", "tokens"))
+}
+
+func TestHybridRateLimiterGlobalOverAdmission(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(testNow)
+	cfg := config.RateLimiter{
+		MaxRequests:  10,
+		UserRequests: 100,
+		Interval:     time.Hour,
+		LeaseSize:    3,
+	}
+	replicas := []*HybridRateLimiter{
+		newTestHybridRateLimiter(t, cfg, mr),
+		newTestHybridRateLimiter(t, cfg, mr),
+	}
+
+	admitted := 0
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			for _, rl := range replicas {
+				if rl.Allow(context.Background(), Request{Key: "192.168.1." + strconv.Itoa(j)}).Allowed {
+					admitted++
+				}
+			}
+		}
+	}
+
+	// Leases of many clients don't add up, each replica admits at most a lease of requests beyond the global limit
+	assert.GreaterOrEqual(t, admitted, 10)
+	assert.LessOrEqual(t, admitted, 10+len(replicas)*cfg.LeaseSize)
+
+	for _, rl := range replicas {
+		rl.sync()
+	}
+	assert.Equal(t, strconv.Itoa(10-admitted), mr.HGet(rateLimiterKeyPrefix+global, "tokens"))
+}
+
+func TestHybridRateLimiterRedisFailure(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(testNow)
+	cfg := config.RateLimiter{
+		MaxRequests:  1000,
+		UserRequests: 100,
+		Interval:     time.Minute,
+		LeaseSize:    10,
+		OnFailure:    FailOpen,
+	}
+	rl := newTestHybridRateLimiter(t, cfg, mr)
+
+	clientIP := "192.168.1.1"
+	for i := 0; i < 5; i++ {
+		assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed)
+	}
+
+	// Requests that can't be synced are kept, and the lease stops admitting locally
+	mr.SetError("ERR connection lost")
+	rl.sync()
+	assert.Equal(t, 4, rl.leases[clientIP].pending)
+	assert.Zero(t, rl.leases[clientIP].tokens)
+	assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "the failure policy decides")
+
+	mr.SetError("")
+	rl.sync()
+	assert.Equal(t, "95", mr.HGet(rateLimiterKeyPrefix+clientIP, "tokens"))
+}
@@ -0,0 +1,149 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+
+	"github.com/ransoor2/ip2country/config"
+)
+
+// Key strategies accepted by config.RateLimitKey.Strategy.
+const (
+	// KeyIP keys anonymous clients by their IP address.
+	KeyIP = "ip"
+	// KeySubnet keys anonymous clients by the network of their IP address.
+	KeySubnet = "subnet"
+	// KeyAPIKey keys clients by their API key.
+	KeyAPIKey = "apikey"
+	// KeyPrincipal keys clients authenticated by other means than an API key, e.g. a JWT, by their identity.
+	KeyPrincipal = "principal"
+	// KeyHeader keys clients by the value of a request header.
+	KeyHeader = "header"
+)
+
+const (
+	defaultIPv4Prefix = 24
+	defaultIPv6Prefix = 64
+)
+
+// Client describes the caller of a request, from which its keys are derived.
+type Client struct {
+	IP string
+	// APIKey is the name of the client's API key, empty for anonymous clients.
+	APIKey string
+	// Principal identifies clients authenticated without an API key, empty for anonymous clients.
+	Principal string
+	Header    http.Header
+}
+
+func (c Client) anonymous() bool {
+	return c.APIKey == "" && c.Principal == ""
+}
+
+// Keyer derives the keys of clients from the configured key strategies.
+type Keyer struct {
+	rules []keyRule
+}
+
+type keyRule struct {
+	strategy   string
+	ipv4Prefix int
+	ipv6Prefix int
+	header     string
+	limit      Limit
+}
+
+// NewKeyer returns a keyer of the configured keys, or of the principal or
+// client IP limited to the limiter's per client limit if there are none.
+func NewKeyer(cfg config.RateLimiter) *Keyer {
+	if len(cfg.Keys) == 0 {
+		return &Keyer{rules: []keyRule{{strategy: KeyPrincipal}, {strategy: KeyIP}}}
+	}
+
+	k := &Keyer{rules: make([]keyRule, 0, len(cfg.Keys))}
+	for _, kc := range cfg.Keys {
+		rule := keyRule{
+			strategy:   kc.Strategy,
+			ipv4Prefix: kc.IPv4Prefix,
+			ipv6Prefix: kc.IPv6Prefix,
+			header:     http.CanonicalHeaderKey(kc.Header),
+			limit:      Limit{Requests: kc.Requests, Burst: kc.Burst, Interval: kc.Interval},
+		}
+		if rule.ipv4Prefix == 0 {
+			rule.ipv4Prefix = defaultIPv4Prefix
+		}
+		if rule.ipv6Prefix == 0 {
+			rule.ipv6Prefix = defaultIPv6Prefix
+		}
+		k.rules = append(k.rules, rule)
+	}
+
+	return k
+}
+
+// Keys returns the keys of client with their limits, in configuration order.
+// Strategies that don't apply to the client are skipped: ip and subnet only
+// apply to anonymous clients, apikey to clients with an API key, principal
+// to other authenticated clients, and header to requests carrying the header.
+func (k *Keyer) Keys(c Client) []KeyLimit {
+	keys := make([]KeyLimit, 0, len(k.rules))
+	for i, rule := range k.rules {
+		key, ok := rule.key(c)
+		if !ok {
+			continue
+		}
+		// Several limits of the same strategy need buckets of their own
+		if slices.ContainsFunc(keys, func(kl KeyLimit) bool { return kl.Key == key }) {
+			key += "#" + strconv.Itoa(i)
+		}
+		keys = append(keys, KeyLimit{Key: key, Limit: rule.limit})
+	}
+
+	return keys
+}
+
+func (r keyRule) key(c Client) (string, bool) {
+	switch r.strategy {
+	case KeyIP:
+		return c.IP, c.anonymous()
+	case KeySubnet:
+		if !c.anonymous() {
+			return "", false
+		}
+		network, ok := subnet(c.IP, r.ipv4Prefix, r.ipv6Prefix)
+		return "net:" + network, ok
+	case KeyAPIKey:
+		return "apikey:" + c.APIKey, c.APIKey != ""
+	case KeyPrincipal:
+		return "principal:" + c.Principal, c.Principal != ""
+	case KeyHeader:
+		value := c.Header.Get(r.header)
+		return "header:" + r.header + ":" + value, value != ""
+	default:
+		return "", false
+	}
+}
+
+// subnet returns the network of ip in CIDR notation, with ipv4Prefix bits of
+// IPv4 addresses and ipv6Prefix bits of IPv6 ones.
+func subnet(ip string, ipv4Prefix, ipv6Prefix int) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+
+	bits := ipv6Prefix
+	if addr.Is4() {
+		bits = ipv4Prefix
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "", false
+	}
+
+	return prefix.String(), true
+}
@@ -0,0 +1,139 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+)
+
+func TestKeyer(t *testing.T) {
+	perSecond := func(requests int) Limit { return Limit{Requests: requests, Interval: time.Second} }
+
+	keyer := NewKeyer(config.RateLimiter{Keys: []config.RateLimitKey{
+		{Strategy: KeyIP, Requests: 5, Interval: time.Second},
+		{Strategy: KeySubnet, Requests: 50, Interval: time.Second},
+		{Strategy: KeySubnet, IPv6Prefix: 48, Requests: 500, Interval: time.Second},
+		{Strategy: KeyAPIKey, Requests: 100, Interval: time.Second},
+		{Strategy: KeyPrincipal, Requests: 30, Interval: time.Second},
+		{Strategy: KeyHeader, Header: "x-tenant", Requests: 20, Interval: time.Second},
+	}})
+
+	tests := []struct {
+		name   string
+		client Client
+		keys   []KeyLimit
+	}{
+		{
+			name:   "IPv4",
+			client: Client{IP: "203.0.113.7"},
+			keys: []KeyLimit{
+				{Key: "203.0.113.7", Limit: perSecond(5)},
+				{Key: "net:203.0.113.0/24", Limit: perSecond(50)},
+				{Key: "net:203.0.113.0/24#2", Limit: perSecond(500)},
+			},
+		},
+		{
+			name:   "IPv6",
+			client: Client{IP: "2001:db8:1:2:3:4:5:6"},
+			keys: []KeyLimit{
+				{Key: "2001:db8:1:2:3:4:5:6", Limit: perSecond(5)},
+				{Key: "net:2001:db8:1:2::/64", Limit: perSecond(50)},
+				{Key: "net:2001:db8:1::/48", Limit: perSecond(500)},
+			},
+		},
+		{
+			name:   "IPv4-mapped IPv6",
+			client: Client{IP: "::ffff:203.0.113.7"},
+			keys: []KeyLimit{
+				{Key: "::ffff:203.0.113.7", Limit: perSecond(5)},
+				{Key: "net:203.0.113.0/24", Limit: perSecond(50)},
+				{Key: "net:203.0.113.0/24#2", Limit: perSecond(500)},
+			},
+		},
+		{
+			name:   "API key and header",
+			client: Client{IP: "203.0.113.7", APIKey: "acme", Header: http.Header{"X-Tenant": {"blue"}}},
+			keys: []KeyLimit{
+				{Key: "apikey:acme", Limit: perSecond(100)},
+				{Key: "header:X-Tenant:blue", Limit: perSecond(20)},
+			},
+		},
+		{
+			name:   "principal",
+			client: Client{IP: "203.0.113.7", Principal: "jwt:alice"},
+			keys:   []KeyLimit{{Key: "principal:jwt:alice", Limit: perSecond(30)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.keys, keyer.Keys(tt.client))
+		})
+	}
+}
+
+func TestKeyerDefault(t *testing.T) {
+	keyer := NewKeyer(config.RateLimiter{UserRequests: 5, UserBurst: 10, Interval: time.Second})
+
+	// The per client limit applies, as it may change at runtime
+	assert.Equal(t, []KeyLimit{{Key: "192.168.1.1"}}, keyer.Keys(Client{IP: "192.168.1.1"}))
+	assert.Equal(t, []KeyLimit{{Key: "principal:jwt:alice"}}, keyer.Keys(Client{IP: "192.168.1.1", Principal: "jwt:alice"}))
+	assert.Empty(t, keyer.Keys(Client{IP: "192.168.1.1", APIKey: "acme"}))
+}
+
+// testSubnetKeys checks a per IP limit of 3 requests along with a per /24 limit of 5.
+func testSubnetKeys(t *testing.T, rl interface {
+	Allow(ctx context.Context, req Request) Decision
+}) {
+	t.Helper()
+
+	keyer := NewKeyer(config.RateLimiter{Keys: []config.RateLimitKey{
+		{Strategy: KeyIP, Requests: 3, Interval: time.Minute},
+		{Strategy: KeySubnet, Requests: 5, Interval: time.Minute},
+	}})
+	allow := func(ip string) Decision {
+		keys := keyer.Keys(Client{IP: ip})
+		return rl.Allow(context.Background(), Request{Key: keys[0].Key, Limit: &keys[0].Limit, Keys: keys[1:]})
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, allow("10.0.0.1").Allowed)
+	}
+	assert.False(t, allow("10.0.0.1").Allowed, "the per IP limit applies")
+
+	// Rotating addresses within the subnet doesn't help
+	d := allow("10.0.0.2")
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 5, d.Limit, "the subnet is the tightest limit")
+	assert.Equal(t, 1, d.Remaining)
+	assert.True(t, allow("10.0.0.3").Allowed)
+	assert.False(t, allow("10.0.0.4").Allowed, "the per subnet limit applies")
+
+	assert.True(t, allow("10.0.1.1").Allowed, "other subnets are not affected")
+}
+
+func TestLocalRateLimiterSubnetKeys(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:   100,
+		UserRequests:  5,
+		Interval:      time.Second,
+		CleanInterval: time.Minute,
+		BucketTTL:     time.Minute,
+	}
+	testSubnetKeys(t, NewLocalRateLimiter(cfg, nil))
+}
+
+func TestDistributedRateLimiterSubnetKeys(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:  100,
+		UserRequests: 5,
+		Interval:     time.Second,
+	}
+	rl, _ := newTestDistributedRateLimiter(t, cfg)
+	testSubnetKeys(t, rl)
+}
@@ -2,6 +2,9 @@ package ratelimiter
 
 import (
 	"context"
+	"fmt"
+	"hash/maphash"
+	"slices"
 	"sync"
 	"time"
 
@@ -9,90 +12,310 @@ import (
 	"github.com/ransoor2/ip2country/pkg/logger"
 )
 
+// shardCount is the number of independently locked bucket maps.
+const shardCount = 64
+
 type LocalRateLimiter struct {
-	log                  logger.Interface
-	buckets              map[string]*Bucket
-	globalBucket         *Bucket
-	mu                   sync.Mutex
-	bucketCapacity       int
-	globalBucketCapacity int
-	refillRate           time.Duration
-	cleanupInterval      time.Duration
-	bucketTTL            time.Duration
+	log             logger.Interface
+	seed            maphash.Seed
+	newState        func(l limit, now time.Time) state
+	shards          [shardCount]bucketShard
+	globalMu        sync.Mutex
+	globalEntry     *entry
+	limits          *limits
+	cleanupInterval time.Duration
+	bucketTTL       time.Duration
+	snapshotFile    string
+	done            chan struct{}
+	closeOnce       sync.Once
+	wg              sync.WaitGroup
+}
+
+type bucketShard struct {
+	mu      sync.Mutex
+	entries map[string]*entry
 }
 
-type Bucket struct {
-	capacity  int
-	remaining int
-	lastCheck time.Time
+// entry holds the algorithm state of a single key until it expires.
+type entry struct {
+	state   state
+	limit   limit
+	expires time.Time
 }
 
+// NewLocalRateLimiter returns an in-memory limiter. With a snapshot file, it
+// restores the buckets saved by the previous process, and saves its own on Close.
 func NewLocalRateLimiter(cfg config.RateLimiter, l logger.Interface) *LocalRateLimiter {
+	now := time.Now()
+	newState := newStateFunc(cfg.Algorithm)
+	limits := newLimits(cfg)
+
 	rl := &LocalRateLimiter{
-		buckets:              make(map[string]*Bucket),
-		globalBucket:         &Bucket{capacity: cfg.MaxRequests, remaining: cfg.MaxRequests, lastCheck: time.Now()},
-		bucketCapacity:       cfg.UserRequests,
-		globalBucketCapacity: cfg.MaxRequests,
-		refillRate:           cfg.Interval,
-		cleanupInterval:      cfg.CleanInterval,
-		bucketTTL:            cfg.BucketTTL,
-		log:                  l,
+		seed:            maphash.MakeSeed(),
+		newState:        newState,
+		globalEntry:     &entry{state: newState(limits.global(), now)},
+		limits:          limits,
+		cleanupInterval: cfg.CleanInterval,
+		bucketTTL:       cfg.BucketTTL,
+		snapshotFile:    cfg.SnapshotFile,
+		done:            make(chan struct{}),
+		log:             l,
 	}
 
+	for i := range rl.shards {
+		rl.shards[i].entries = make(map[string]*entry)
+	}
+
+	if rl.snapshotFile != "" {
+		// A missing or broken snapshot only costs clients' usage so far, start afresh
+		restored, err := rl.restore(rl.snapshotFile, cfg.Algorithm)
+		if err != nil {
+			l.Error(fmt.Errorf("ratelimiter - NewLocalRateLimiter - starting without snapshot: %w", err))
+		} else {
+			l.Info("ratelimiter - NewLocalRateLimiter - restored %d buckets from %s", restored, rl.snapshotFile)
+		}
+	}
+
+	rl.wg.Add(1)
 	go rl.cleanupBuckets()
 
 	return rl
 }
 
-func (rl *LocalRateLimiter) Allow(_ context.Context, clientIP string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+func (rl *LocalRateLimiter) Allow(_ context.Context, req Request) Decision {
+	now := time.Now()
 
-	// Check if the clientIP bucket exists, if not create a new one
-	bucket, exists := rl.buckets[clientIP]
-	if !exists {
-		bucket = &Bucket{capacity: rl.bucketCapacity, remaining: rl.bucketCapacity, lastCheck: time.Now()}
-		rl.buckets[clientIP] = bucket
+	clientLimit := rl.limits.client()
+	if req.Limit != nil {
+		clientLimit = req.Limit.limit()
+	}
+
+	keys := make([]string, 0, len(req.Keys)+len(req.Quotas)+1)
+	keys = append(keys, req.Key)
+	for _, k := range req.Keys {
+		keys = append(keys, k.Key)
+	}
+	for _, q := range req.Quotas {
+		keys = append(keys, q.key(req.Key))
+	}
+
+	unlock := rl.lockShards(keys)
+	defer unlock()
+
+	buckets := make([]bucket, 0, len(keys)+1)
+	buckets = append(buckets, rl.rateBucket(req.Key, clientLimit, now))
+	for _, k := range req.Keys {
+		buckets = append(buckets, rl.rateBucket(k.Key, k.Limit.limitOr(rl.limits.client()), now))
+	}
+
+	for i, q := range req.Quotas {
+		qe := rl.entry(keys[1+len(req.Keys)+i], func() state { return &quotaWindow{period: q.Period} })
+		_, qe.expires = q.Period.window(now)
+		qe.limit = limit{requests: q.Requests}
+		buckets = append(buckets, bucket{state: qe.state, limit: qe.limit})
+	}
+
+	// Reject without touching the contended global bucket when the client is over its limits
+	for _, b := range buckets {
+		if u := b.state.usage(b.limit, now, req.cost()); u.retryAfter > 0 {
+			return decide(now, req.cost(), buckets...)
+		}
 	}
 
+	// Lock order is always shards first, then global
+	rl.globalMu.Lock()
+	defer rl.globalMu.Unlock()
+
+	buckets = append(buckets, bucket{state: rl.globalEntry.state, limit: rl.limits.global(), shared: true})
+
+	return decide(now, req.cost(), buckets...)
+}
+
+// Inspect returns the state of key's bucket, or of the global bucket for "global".
+func (rl *LocalRateLimiter) Inspect(_ context.Context, key string) (KeyState, error) {
 	now := time.Now()
 
-	// Refill clientIP bucket
-	elapsed := now.Sub(bucket.lastCheck)
-	if elapsed >= rl.refillRate {
-		bucket.remaining = bucket.capacity
-		bucket.lastCheck = now
+	if key == global {
+		rl.globalMu.Lock()
+		defer rl.globalMu.Unlock()
+
+		return inspect(key, &entry{state: rl.globalEntry.state, limit: rl.limits.global()}, now), nil
 	}
 
-	// Refill global bucket
-	globalElapsed := now.Sub(rl.globalBucket.lastCheck)
-	if globalElapsed >= rl.refillRate {
-		rl.globalBucket.remaining = rl.globalBucket.capacity
-		rl.globalBucket.lastCheck = now
+	shard := rl.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	e, ok := shard.entries[key]
+	if !ok || isQuotaKey(key) || now.After(e.expires) {
+		return KeyState{}, ErrNotFound
 	}
 
-	// Check if there are enough tokens in both the clientIP and global bucket
-	if bucket.remaining > 0 && rl.globalBucket.remaining > 0 {
-		bucket.remaining--
-		rl.globalBucket.remaining--
-		return true
+	return inspect(key, e, now), nil
+}
+
+// TopConsumers returns the n keys that used the most of their limit.
+func (rl *LocalRateLimiter) TopConsumers(_ context.Context, n int) ([]KeyState, error) {
+	now := time.Now()
+
+	var states []KeyState
+	for i := range rl.shards {
+		shard := &rl.shards[i]
+		shard.mu.Lock()
+		for key, e := range shard.entries {
+			if !isQuotaKey(key) && !now.After(e.expires) {
+				states = append(states, inspect(key, e, now))
+			}
+		}
+		shard.mu.Unlock()
 	}
 
-	return false
+	return topConsumers(states, n), nil
+}
+
+// Reset drops the bucket of key, so that its next request starts afresh.
+// Resetting "global" refills the global bucket.
+func (rl *LocalRateLimiter) Reset(_ context.Context, key string) error {
+	if key == global {
+		rl.globalMu.Lock()
+		defer rl.globalMu.Unlock()
+
+		rl.globalEntry = &entry{state: rl.newState(rl.limits.global(), time.Now())}
+		return nil
+	}
+
+	shard := rl.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if _, ok := shard.entries[key]; !ok {
+		return ErrNotFound
+	}
+	delete(shard.entries, key)
+
+	return nil
+}
+
+// Limits returns the current global and per client limits.
+func (rl *LocalRateLimiter) Limits() Limits {
+	return rl.limits.get()
+}
+
+// SetLimits replaces the global and per client limits. Buckets keep their
+// state, and are held to the new limits from their next request on.
+func (rl *LocalRateLimiter) SetLimits(_ context.Context, l Limits) error {
+	rl.limits.set(l)
+
+	return nil
+}
+
+// inspect returns the state of key's entry as of now. The entry's shard must be locked.
+func inspect(key string, e *entry, now time.Time) KeyState {
+	var lastRefill time.Time
+	if b, ok := e.state.(*tokenBucket); ok {
+		lastRefill = b.lastCheck
+	}
+
+	u := e.state.usage(e.limit, now, 0)
+	s := KeyState{Key: key, Limit: u.limit, Remaining: u.remaining, Reset: u.reset, LastRefill: lastRefill}
+	if !e.expires.IsZero() {
+		s.TTL = e.expires.Sub(now)
+	}
+
+	return s
+}
+
+// rateBucket returns the bucket of key, creating its entry if it does not exist.
+// The shard of key must be locked.
+func (rl *LocalRateLimiter) rateBucket(key string, l limit, now time.Time) bucket {
+	e := rl.entry(key, func() state { return rl.newState(l, now) })
+	e.limit = l
+	e.expires = now.Add(rl.bucketTTL)
+
+	return bucket{state: e.state, limit: l}
+}
+
+// entry returns the entry of key, creating it with newState if it does not exist.
+// The shard of key must be locked.
+func (rl *LocalRateLimiter) entry(key string, newState func() state) *entry {
+	shard := rl.shard(key)
+
+	e, exists := shard.entries[key]
+	if !exists {
+		e = &entry{state: newState()}
+		shard.entries[key] = e
+	}
+
+	return e
+}
+
+func (rl *LocalRateLimiter) shard(key string) *bucketShard {
+	return &rl.shards[rl.shardIndex(key)]
+}
+
+func (rl *LocalRateLimiter) shardIndex(key string) int {
+	return int(maphash.String(rl.seed, key) % shardCount)
+}
+
+// lockShards locks the shards of keys in index order, so that concurrent
+// requests never wait for each other's shards in a cycle.
+func (rl *LocalRateLimiter) lockShards(keys []string) (unlock func()) {
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, rl.shardIndex(key))
+	}
+	slices.Sort(indexes)
+	indexes = slices.Compact(indexes)
+
+	for _, i := range indexes {
+		rl.shards[i].mu.Lock()
+	}
+
+	return func() {
+		for _, i := range indexes {
+			rl.shards[i].mu.Unlock()
+		}
+	}
+}
+
+// Close stops cleaning up buckets, and saves them to the snapshot file if there is one.
+func (rl *LocalRateLimiter) Close() {
+	rl.closeOnce.Do(func() {
+		close(rl.done)
+		rl.wg.Wait()
+
+		if rl.snapshotFile == "" {
+			return
+		}
+		if err := rl.save(rl.snapshotFile); err != nil {
+			rl.log.Error(fmt.Errorf("ratelimiter - LocalRateLimiter - Close: %w", err))
+		}
+	})
 }
 
 func (rl *LocalRateLimiter) cleanupBuckets() {
+	defer rl.wg.Done()
+
 	ticker := time.NewTicker(rl.cleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		rl.mu.Lock()
+	for {
+		select {
+		case <-rl.done:
+			return
+		case <-ticker.C:
+		}
+
 		now := time.Now()
-		for ip, bucket := range rl.buckets {
-			if now.Sub(bucket.lastCheck) > rl.bucketTTL {
-				delete(rl.buckets, ip)
+		for i := range rl.shards {
+			shard := &rl.shards[i]
+			shard.mu.Lock()
+			for key, e := range shard.entries {
+				if now.After(e.expires) {
+					delete(shard.entries, key)
+				}
 			}
+			shard.mu.Unlock()
 		}
-		rl.mu.Unlock()
 	}
 }
@@ -2,6 +2,9 @@ package ratelimiter
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,17 +27,17 @@ func TestLocalRateLimiter(t *testing.T) {
 
 	// Test allowing requests within the limit
 	for i := 0; i < 5; i++ {
-		assert.True(t, rl.Allow(context.Background(), clientIP), "Request should be allowed")
+		assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be allowed")
 	}
 
 	// Test exceeding the limit
-	assert.False(t, rl.Allow(context.Background(), clientIP), "Request should be denied")
+	assert.False(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be denied")
 
 	// Wait for the refill rate duration and test again
 	time.Sleep(time.Second)
 
 	for i := 0; i < 5; i++ {
-		assert.True(t, rl.Allow(context.Background(), clientIP), "Request should be allowed")
+		assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be allowed")
 	}
 }
 
@@ -53,20 +56,20 @@ func TestGlobalRateLimiter(t *testing.T) {
 
 	// Test allowing requests within the global limit
 	for i := 0; i < 5; i++ {
-		assert.True(t, rl.Allow(context.Background(), clientIP1), "Request should be allowed for clientIP1")
-		assert.True(t, rl.Allow(context.Background(), clientIP2), "Request should be allowed for clientIP2")
+		assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP1}).Allowed, "Request should be allowed for clientIP1")
+		assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP2}).Allowed, "Request should be allowed for clientIP2")
 	}
 
 	// Test exceeding the global limit
-	assert.False(t, rl.Allow(context.Background(), clientIP1), "Request should be denied for clientIP1")
-	assert.False(t, rl.Allow(context.Background(), clientIP2), "Request should be denied for clientIP2")
+	assert.False(t, rl.Allow(context.Background(), Request{Key: clientIP1}).Allowed, "Request should be denied for clientIP1")
+	assert.False(t, rl.Allow(context.Background(), Request{Key: clientIP2}).Allowed, "Request should be denied for clientIP2")
 
 	// Wait for the refill rate duration and test again
 	time.Sleep(time.Second)
 
 	// Check the global bucket capacity
-	assert.True(t, rl.Allow(context.Background(), clientIP1), "Request should be allowed for clientIP1 after refill")
-	assert.True(t, rl.Allow(context.Background(), clientIP2), "Request should be allowed for clientIP2 after refill")
+	assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP1}).Allowed, "Request should be allowed for clientIP1 after refill")
+	assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP2}).Allowed, "Request should be allowed for clientIP2 after refill")
 }
 
 func TestBucketCleanup(t *testing.T) {
@@ -82,20 +85,107 @@ func TestBucketCleanup(t *testing.T) {
 	clientIP := "192.168.1.1"
 
 	// Allow a request to create the bucket
-	assert.True(t, rl.Allow(context.Background(), clientIP), "Request should be allowed")
+	assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be allowed")
 
 	// Ensure the bucket exists
-	rl.mu.Lock()
-	_, exists := rl.buckets[clientIP]
-	rl.mu.Unlock()
+	shard := rl.shard(clientIP)
+	shard.mu.Lock()
+	_, exists := shard.entries[clientIP]
+	shard.mu.Unlock()
 	assert.True(t, exists, "Bucket should exist")
 
 	// Wait for the bucket TTL to expire
 	time.Sleep(time.Second * 3)
 
 	// Ensure the bucket has been cleaned up
-	rl.mu.Lock()
-	_, exists = rl.buckets[clientIP]
-	rl.mu.Unlock()
+	shard.mu.Lock()
+	_, exists = shard.entries[clientIP]
+	shard.mu.Unlock()
 	assert.False(t, exists, "Bucket should be cleaned up")
 }
+
+func TestLocalRateLimiterContinuousRefill(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:   100,
+		UserRequests:  5,
+		UserBurst:     2,
+		Interval:      time.Second,
+		CleanInterval: time.Second * 10,
+		BucketTTL:     time.Second * 5,
+	}
+	rl := NewLocalRateLimiter(cfg, nil)
+
+	clientIP := "192.168.1.1"
+
+	// The burst caps the bucket below the per-interval rate
+	assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be allowed")
+	assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be allowed")
+	assert.False(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be denied")
+
+	// One token is refilled every 200ms
+	time.Sleep(250 * time.Millisecond)
+	assert.True(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be allowed after partial refill")
+	assert.False(t, rl.Allow(context.Background(), Request{Key: clientIP}).Allowed, "Request should be denied")
+}
+
+func TestLocalRateLimiterConcurrent(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:   50,
+		UserRequests:  5,
+		Interval:      time.Hour,
+		CleanInterval: time.Second * 10,
+		BucketTTL:     time.Second * 5,
+	}
+	rl := NewLocalRateLimiter(cfg, nil)
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clientIP := fmt.Sprintf("10.0.0.%d", i)
+			for j := 0; j < 10; j++ {
+				if rl.Allow(context.Background(), Request{Key: clientIP}).Allowed {
+					allowed.Add(1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// The global bucket caps the total no matter how requests interleave
+	assert.Equal(t, int64(50), allowed.Load())
+}
+
+func TestLocalRateLimiterRequestLimitAndQuota(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:   100,
+		UserRequests:  5,
+		Interval:      time.Second,
+		CleanInterval: time.Second * 10,
+		BucketTTL:     time.Second * 5,
+	}
+	rl := NewLocalRateLimiter(cfg, nil)
+
+	req := Request{
+		Key:    "key:partner",
+		Limit:  &Limit{Requests: 50, Interval: time.Second},
+		Quotas: []Quota{{Period: Daily, Requests: 20}},
+	}
+
+	// The request limit replaces the per client limit, and the quota applies on top of it
+	for i := 0; i < 20; i++ {
+		assert.True(t, rl.Allow(context.Background(), req).Allowed, "Request should be allowed")
+	}
+
+	d := rl.Allow(context.Background(), req)
+	assert.False(t, d.Allowed, "Request should be denied")
+	assert.Equal(t, 20, d.Limit)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Greater(t, d.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, d.RetryAfter, 24*time.Hour)
+
+	// Other clients keep the configured limit
+	assert.Equal(t, 5, rl.Allow(context.Background(), Request{Key: "192.168.1.1"}).Limit)
+}
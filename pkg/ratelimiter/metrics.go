@@ -0,0 +1,23 @@
+package ratelimiter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	redisErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ratelimiter_redis_errors_total",
+		Help: "Number of failed Redis rate limiting calls.",
+	})
+
+	fallbackDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ratelimiter_fallback_decisions_total",
+		Help: "Number of rate limiting decisions taken by the failure policy instead of Redis.",
+	}, []string{"policy"})
+
+	breakerStateGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ratelimiter_breaker_state",
+		Help: "State of the Redis circuit breaker: 0 closed, 1 open, 2 half-open.",
+	})
+)
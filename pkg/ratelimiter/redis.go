@@ -0,0 +1,92 @@
+package ratelimiter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ransoor2/ip2country/config"
+)
+
+// Redis deployment modes accepted by config.RateLimiter.RedisMode.
+const (
+	RedisStandalone = "standalone"
+	RedisSentinel   = "sentinel"
+	RedisCluster    = "cluster"
+)
+
+// clusterKeyPrefix hash-tags every key into the same cluster slot, since
+// the script touches the global key and a client's keys at once.
+const clusterKeyPrefix = "{rate_limiter}:"
+
+// newRedisClient connects to a standalone server, a Sentinel-managed master,
+// or a cluster, depending on cfg.RedisMode.
+func newRedisClient(cfg config.RateLimiter) (redis.UniversalClient, error) {
+	addrs := cfg.RedisAddrs
+	if len(addrs) == 0 {
+		addrs = []string{cfg.RedisAddr}
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            addrs,
+		MasterName:       cfg.RedisMasterName,
+		Username:         cfg.RedisUsername,
+		Password:         cfg.RedisPassword,
+		SentinelPassword: cfg.SentinelPassword,
+		DB:               cfg.RedisDB,
+		PoolSize:         cfg.RedisPoolSize,
+		DialTimeout:      cfg.RedisDialTimeout,
+		ReadTimeout:      cfg.RedisReadTimeout,
+		WriteTimeout:     cfg.RedisWriteTimeout,
+	}
+
+	if cfg.RedisTLS {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	switch cfg.RedisMode {
+	case RedisSentinel:
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case RedisCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return redis.NewClient(opts.Simple()), nil
+	}
+}
+
+func newTLSConfig(cfg config.RateLimiter) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.RedisServerName,
+	}
+
+	if cfg.RedisCAFile != "" {
+		ca, err := os.ReadFile(cfg.RedisCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ratelimiter - newTLSConfig - os.ReadFile: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("ratelimiter - newTLSConfig - no certificates in %s", cfg.RedisCAFile)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// keyPrefix returns the prefix of the limiter's keys in the given mode.
+func keyPrefix(mode string) string {
+	if mode == RedisCluster {
+		return clusterKeyPrefix
+	}
+
+	return rateLimiterKeyPrefix
+}
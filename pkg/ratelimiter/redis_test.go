@@ -0,0 +1,74 @@
+package ratelimiter
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+func TestDistributedRateLimiterCluster(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cfg := config.RateLimiter{
+		MaxRequests:  10,
+		UserRequests: 1,
+		Interval:     time.Second,
+		RedisMode:    RedisCluster,
+		RedisAddrs:   []string{mr.Addr()},
+	}
+	rl, err := NewDistributedRateLimiter(cfg, logger.New("debug"))
+	assert.NoError(t, err)
+
+	assert.True(t, rl.Allow(context.Background(), Request{Key: "192.168.1.1"}).Allowed)
+	assert.False(t, rl.Allow(context.Background(), Request{Key: "192.168.1.1"}).Allowed)
+
+	// Keys share a hash tag so the script may touch them at once
+	assert.True(t, mr.Exists("{rate_limiter}:global"))
+	assert.True(t, mr.Exists("{rate_limiter}:192.168.1.1"))
+
+	// Keys are scanned on every master
+	top, err := rl.TopConsumers(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Len(t, top, 1)
+	assert.Equal(t, "192.168.1.1", top[0].Key)
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	assert.NoError(t, os.WriteFile(caFile, ca, 0o600))
+
+	emptyFile := filepath.Join(dir, "empty.pem")
+	assert.NoError(t, os.WriteFile(emptyFile, nil, 0o600))
+
+	tlsConfig, err := newTLSConfig(config.RateLimiter{RedisCAFile: caFile, RedisServerName: "redis.internal"})
+	assert.NoError(t, err)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Equal(t, "redis.internal", tlsConfig.ServerName)
+
+	tlsConfig, err = newTLSConfig(config.RateLimiter{})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig.RootCAs, "system roots are used without a CA file")
+
+	_, err = newTLSConfig(config.RateLimiter{RedisCAFile: filepath.Join(dir, "missing.pem")})
+	assert.Error(t, err)
+
+	_, err = newTLSConfig(config.RateLimiter{RedisCAFile: emptyFile})
+	assert.Error(t, err)
+
+	_, err = NewDistributedRateLimiter(config.RateLimiter{RedisTLS: true, RedisCAFile: emptyFile}, logger.New("debug"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package ratelimiter
+
+import (
+	"time"
+)
+
+// Request identifies the client of a rate limited request and the limits it is subject to.
+type Request struct {
+	// Key identifies the client, e.g. its IP address or API key.
+	Key string
+	// Limit replaces the configured per client limit when set.
+	Limit *Limit
+	// Keys are further keys of the client limited along with Key, e.g. its subnet.
+	Keys []KeyLimit
+	// Quotas are long-term allowances of the client, enforced on top of Limit.
+	Quotas []Quota
+	// Cost is the number of requests the request counts for, 1 if not set.
+	Cost int
+}
+
+func (r Request) cost() int {
+	return max(1, r.Cost)
+}
+
+// Limit allows Requests per Interval, with bursts of up to Burst requests
+// where the algorithm supports it. A non-positive Burst defaults to Requests.
+type Limit struct {
+	Requests int
+	Burst    int
+	Interval time.Duration
+}
+
+func (l Limit) limit() limit {
+	return newLimit(l.Requests, l.Burst, l.Interval)
+}
+
+// limitOr returns the limit of l, or def if l is zero.
+func (l Limit) limitOr(def limit) limit {
+	if l == (Limit{}) {
+		return def
+	}
+
+	return l.limit()
+}
+
+// KeyLimit limits a key to Limit, or to the limiter's per client limit if Limit is zero.
+type KeyLimit struct {
+	Key   string
+	Limit Limit
+}
+
+// Period is the calendar period a quota applies to, in UTC.
+type Period string
+
+// Quota periods.
+const (
+	Daily   Period = "daily"
+	Monthly Period = "monthly"
+)
+
+// window returns the bounds of the period containing now.
+func (p Period) window(now time.Time) (start, end time.Time) {
+	now = now.UTC()
+	switch p {
+	case Monthly:
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+// Quota allows Requests per Period.
+type Quota struct {
+	Period   Period
+	Requests int
+}
+
+func (q Quota) key(clientKey string) string {
+	return "quota:" + string(q.Period) + ":" + clientKey
+}
@@ -0,0 +1,314 @@
+package ratelimiter
+
+import (
+	"github.com/redis/go-redis/v9"
+)
+
+// The distributed algorithms run as Lua scripts so that check-and-consume is
+// atomic across all keys of a request. Every script is made of an algorithm
+// specific part defining load, usage and consume, wrapped by the same driver:
+// a request is admitted only if every key allows it, and no key is charged
+// otherwise, unless charging is forced. The script returns the decision of the
+// most restrictive key as {allowed, limit, remaining, reset (ms), retry after
+// (ms), cost exceeds limit}. The global key is only reported when it rejects
+// the request. Requests costing more than the limit of a key are rejected with
+// that key, the one of the lowest limit, without a retry time.
+//
+//	KEYS[1]                            - the global key
+//	KEYS[i]                            - key of the i-th bucket; rate limits first, then quotas
+//	ARGV[1]                            - requests to consume
+//	ARGV[2]                            - number of rate limit keys
+//	ARGV[3]                            - 1 to charge every key even if the request is rejected
+//	ARGV[3i+1], ARGV[3i+2], ARGV[3i+3] - requests, burst and interval (ms) of a rate limit key,
+//	                                     or requests, window start and window end (ms) of a quota key
+const (
+	scriptPrologue = `
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local cost = tonumber(ARGV[1])
+local rateLimits = tonumber(ARGV[2])
+local force = ARGV[3] == '1'
+
+local function limit(i)
+	return {
+		requests = tonumber(ARGV[3 * i + 1]),
+		burst = tonumber(ARGV[3 * i + 2]),
+		interval = tonumber(ARGV[3 * i + 3]),
+	}
+end
+
+local function quota(i)
+	return {
+		requests = tonumber(ARGV[3 * i + 1]),
+		start = tonumber(ARGV[3 * i + 2]),
+		finish = tonumber(ARGV[3 * i + 3]),
+	}
+end
+
+-- Quotas are hashes {start, count} of the current calendar period.
+local quotas = {}
+
+function quotas.load(key, q)
+	local state = redis.call('HMGET', key, 'start', 'count')
+	local count = tonumber(state[2]) or 0
+	if tonumber(state[1]) ~= q.start then
+		count = 0
+	end
+	return {key = key, count = count}
+end
+
+function quotas.usage(st, q)
+	local u = {limit = q.requests, remaining = q.requests - st.count, reset = 0, retry = 0}
+	if st.count > 0 then
+		u.reset = q.finish - now
+	end
+	if st.count + cost > q.requests then
+		u.retry = q.finish - now
+	end
+	return u
+end
+
+function quotas.consume(st, q)
+	st.count = st.count + cost
+	redis.call('HSET', st.key, 'start', q.start, 'count', st.count)
+	redis.call('PEXPIREAT', st.key, q.finish)
+end
+`
+
+	scriptDriver = `
+local rates = {load = load, usage = usage, consume = consume}
+
+-- bucket returns the functions and limit of the i-th key
+local function bucket(i)
+	if i <= rateLimits then
+		return rates, limit(i)
+	end
+	return quotas, quota(i)
+end
+
+local function reply(allowed, u, exceeded)
+	return {allowed, u.limit, math.max(0, math.floor(u.remaining)), math.ceil(u.reset), math.ceil(u.retry), exceeded}
+end
+
+local states = {}
+local denied = nil
+local exceeded = nil
+for i, key in ipairs(KEYS) do
+	local impl, l = bucket(i)
+	local st = impl.load(key, l)
+	local u = impl.usage(st, l)
+	if cost > u.limit and (exceeded == nil or u.limit < exceeded.limit) then
+		exceeded = u
+	end
+	if u.retry > 0 and (denied == nil or u.retry > denied.retry) then
+		denied = u
+	end
+	states[i] = st
+end
+
+if exceeded ~= nil then
+	exceeded.retry = 0
+	denied = exceeded
+end
+if denied ~= nil and not force then
+	return reply(0, denied, exceeded and 1 or 0)
+end
+
+local tightest = nil
+for i in ipairs(KEYS) do
+	local impl, l = bucket(i)
+	impl.consume(states[i], l)
+	local u = impl.usage(states[i], l)
+	u.retry = 0
+	if i > 1 and (tightest == nil or u.remaining < tightest.remaining) then
+		tightest = u
+	end
+end
+
+if denied ~= nil then
+	return reply(0, denied, exceeded and 1 or 0)
+end
+return reply(1, tightest, 0)
+`
+
+	inspectDriver = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return {0}
+end
+local l = limit(1)
+local u = usage(load(KEYS[1], l), l)
+local refill = 0
+if redis.call('TYPE', KEYS[1]).ok == 'hash' then
+	refill = tonumber(redis.call('HGET', KEYS[1], 'ts')) or 0
+end
+return {1, u.limit, math.max(0, math.floor(u.remaining)), math.ceil(u.reset), refill, redis.call('PTTL', KEYS[1])}
+`
+
+	// Buckets are hashes {tokens, ts} that expire once they would be full again.
+	tokenBucketLua = `
+local function load(key, l)
+	local state = redis.call('HMGET', key, 'tokens', 'ts')
+	local tokens = tonumber(state[1])
+	local ts = tonumber(state[2])
+	if tokens == nil or ts == nil then
+		tokens = l.burst
+	else
+		tokens = math.min(l.burst, tokens + math.max(0, now - ts) * l.requests / l.interval)
+	end
+	return {key = key, tokens = tokens}
+end
+
+local function usage(st, l)
+	local tokenTime = l.interval / l.requests
+	return {
+		limit = l.burst,
+		remaining = st.tokens,
+		reset = (l.burst - st.tokens) * tokenTime,
+		retry = math.max(0, cost - st.tokens) * tokenTime,
+	}
+end
+
+local function consume(st, l)
+	st.tokens = st.tokens - cost
+	redis.call('HSET', st.key, 'tokens', tostring(st.tokens), 'ts', now)
+	redis.call('PEXPIRE', st.key, math.ceil((l.burst - st.tokens) * l.interval / l.requests) + 1)
+end
+`
+
+	// The log is a sorted set of admitted requests scored by their timestamp.
+	slidingWindowLogLua = `
+local function load(key, l)
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - l.interval)
+	return {key = key, count = redis.call('ZCARD', key)}
+end
+
+local function expiry(st, l, index)
+	local entry = redis.call('ZRANGE', st.key, index, index, 'WITHSCORES')
+	return tonumber(entry[2]) + l.interval - now
+end
+
+local function usage(st, l)
+	local u = {limit = l.requests, remaining = l.requests - st.count, reset = 0, retry = 0}
+	if st.count > 0 then
+		u.reset = expiry(st, l, -1)
+	end
+	-- The oldest requests have to leave the window first
+	local expiring = st.count + cost - l.requests
+	if cost > l.requests then
+		u.retry = l.interval
+	elseif expiring > 0 then
+		u.retry = expiry(st, l, expiring - 1)
+	end
+	return u
+end
+
+local function consume(st, l)
+	for n = 0, cost - 1 do
+		redis.call('ZADD', st.key, now, now .. '-' .. (st.count + n))
+	end
+	st.count = st.count + cost
+	redis.call('PEXPIRE', st.key, l.interval)
+end
+`
+
+	// Counters are hashes {window, current, previous} of the fixed windows.
+	slidingWindowCounterLua = `
+local function load(key, l)
+	local window = math.floor(now / l.interval)
+	local state = redis.call('HMGET', key, 'window', 'current', 'previous')
+	local stored = tonumber(state[1])
+	local current = tonumber(state[2]) or 0
+	local previous = tonumber(state[3]) or 0
+	if stored == window - 1 then
+		previous, current = current, 0
+	elseif stored ~= window then
+		previous, current = 0, 0
+	end
+	return {key = key, window = window, current = current, previous = previous}
+end
+
+local function usage(st, l)
+	local elapsed = (now - st.window * l.interval) / l.interval
+	local estimate = st.previous * (1 - elapsed) + st.current
+	local u = {limit = l.requests, remaining = l.requests - estimate, reset = 0, retry = 0}
+	if st.current > 0 then
+		u.reset = (2 - elapsed) * l.interval
+	elseif st.previous > 0 then
+		u.reset = (1 - elapsed) * l.interval
+	end
+	if estimate + cost <= l.requests then
+		return u
+	end
+	if cost > l.requests then
+		u.retry = l.interval
+	elseif st.current + cost <= l.requests then
+		-- Wait for the previous window's weight to drop enough
+		u.retry = (1 - (l.requests - st.current - cost) / st.previous - elapsed) * l.interval
+	else
+		-- Wait for the current window to become the previous one and lose enough weight
+		u.retry = (2 - (l.requests - cost) / st.current - elapsed) * l.interval
+	end
+	return u
+end
+
+local function consume(st, l)
+	st.current = st.current + cost
+	redis.call('HSET', st.key, 'window', st.window, 'current', st.current, 'previous', st.previous)
+	redis.call('PEXPIRE', st.key, 2 * l.interval)
+end
+`
+
+	// The state is the theoretical arrival time (TAT) of the next request.
+	gcraLua = `
+local function load(key, l)
+	local tat = tonumber(redis.call('GET', key))
+	if tat == nil or tat < now then
+		tat = now
+	end
+	return {key = key, tat = tat}
+end
+
+local function usage(st, l)
+	local emission = l.interval / l.requests
+	local tolerance = l.burst * emission
+	local ahead = st.tat - now
+	return {
+		limit = l.burst,
+		remaining = (tolerance - ahead) / emission,
+		reset = ahead,
+		retry = math.max(0, ahead + cost * emission - tolerance),
+	}
+end
+
+local function consume(st, l)
+	st.tat = st.tat + cost * l.interval / l.requests
+	redis.call('SET', st.key, tostring(st.tat), 'PX', math.ceil(st.tat - now) + 1)
+end
+`
+)
+
+func newScript(algorithm string) *redis.Script {
+	return redis.NewScript(scriptPrologue + algorithmLua(algorithm) + scriptDriver)
+}
+
+// newInspectScript returns the script reporting a key's usage as
+// {exists, limit, remaining, reset (ms), last refill (ms), ttl (ms)}, with
+// the arguments of a request of no cost limited by a single key. It loads the
+// key as the algorithm does, without charging it. Only token buckets record
+// their last refill, it is zero for the other algorithms.
+func newInspectScript(algorithm string) *redis.Script {
+	return redis.NewScript(scriptPrologue + algorithmLua(algorithm) + inspectDriver)
+}
+
+func algorithmLua(algorithm string) string {
+	switch algorithm {
+	case AlgorithmSlidingWindowLog:
+		return slidingWindowLogLua
+	case AlgorithmSlidingWindowCounter:
+		return slidingWindowCounterLua
+	case AlgorithmGCRA:
+		return gcraLua
+	default:
+		return tokenBucketLua
+	}
+}
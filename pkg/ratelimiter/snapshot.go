@@ -0,0 +1,179 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// kindQuota marks the entries of quotas in snapshots, next to the algorithms.
+const kindQuota = "quota"
+
+// snapshot is the persisted form of a local limiter's live buckets. States
+// hold absolute times, so restored buckets have aged by the time the process
+// was down: token buckets refilled, logged requests left their window, and
+// entries that expired in the meantime are dropped.
+type snapshot struct {
+	Taken   time.Time       `json:"taken"`
+	Global  *entrySnapshot  `json:"global,omitempty"`
+	Entries []entrySnapshot `json:"entries"`
+}
+
+// entrySnapshot is the persisted form of an entry. Kind is the algorithm of
+// the entry's state, or quota, and tells which of the state fields are set.
+type entrySnapshot struct {
+	Key      string        `json:"key,omitempty"`
+	Kind     string        `json:"kind"`
+	Requests int           `json:"requests"`
+	Burst    int           `json:"burst"`
+	Interval time.Duration `json:"interval"`
+	Expires  time.Time     `json:"expires"`
+	// Tokens of token buckets
+	Tokens float64 `json:"tokens,omitempty"`
+	// Time is the last refill of token buckets, the window of sliding window
+	// counters, the TAT of GCRA and the period start of quotas
+	Time time.Time `json:"time"`
+	// Log of sliding window logs
+	Log []time.Time `json:"log,omitempty"`
+	// Current and Previous counts of sliding window counters, Current is the count of quotas
+	Current  int    `json:"current,omitempty"`
+	Previous int    `json:"previous,omitempty"`
+	Period   Period `json:"period,omitempty"`
+}
+
+func newEntrySnapshot(key string, e *entry) entrySnapshot {
+	s := entrySnapshot{
+		Key:      key,
+		Requests: e.limit.requests,
+		Burst:    e.limit.burst,
+		Interval: e.limit.interval,
+		Expires:  e.expires,
+	}
+
+	switch st := e.state.(type) {
+	case *tokenBucket:
+		s.Kind, s.Tokens, s.Time = AlgorithmTokenBucket, st.tokens, st.lastCheck
+	case *slidingWindowLog:
+		s.Kind, s.Log = AlgorithmSlidingWindowLog, st.log
+	case *slidingWindowCounter:
+		s.Kind, s.Time, s.Current, s.Previous = AlgorithmSlidingWindowCounter, st.window, st.current, st.previous
+	case *gcra:
+		s.Kind, s.Time = AlgorithmGCRA, st.tat
+	case *quotaWindow:
+		s.Kind, s.Period, s.Time, s.Current = kindQuota, st.period, st.start, st.count
+	}
+
+	return s
+}
+
+// entry returns the entry of the snapshot.
+func (s entrySnapshot) entry() *entry {
+	e := &entry{
+		limit:   limit{requests: s.Requests, burst: s.Burst, interval: s.Interval},
+		expires: s.Expires,
+	}
+
+	switch s.Kind {
+	case AlgorithmSlidingWindowLog:
+		e.state = &slidingWindowLog{log: s.Log}
+	case AlgorithmSlidingWindowCounter:
+		e.state = &slidingWindowCounter{window: s.Time, current: s.Current, previous: s.Previous}
+	case AlgorithmGCRA:
+		e.state = &gcra{tat: s.Time}
+	case kindQuota:
+		e.state = &quotaWindow{period: s.Period, start: s.Time, count: s.Current}
+	default:
+		e.state = &tokenBucket{tokens: s.Tokens, lastCheck: s.Time}
+	}
+
+	return e
+}
+
+// save writes the live buckets to path, replacing it at once so that a crash
+// never leaves a partial snapshot behind.
+func (rl *LocalRateLimiter) save(path string) error {
+	now := time.Now()
+	snap := snapshot{Taken: now}
+
+	rl.globalMu.Lock()
+	global := newEntrySnapshot("", &entry{state: rl.globalEntry.state, limit: rl.limits.global()})
+	rl.globalMu.Unlock()
+	snap.Global = &global
+
+	for i := range rl.shards {
+		shard := &rl.shards[i]
+		shard.mu.Lock()
+		for key, e := range shard.entries {
+			if !now.After(e.expires) {
+				snap.Entries = append(snap.Entries, newEntrySnapshot(key, e))
+			}
+		}
+		shard.mu.Unlock()
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("ratelimiter - LocalRateLimiter - save - json.Marshal: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("ratelimiter - LocalRateLimiter - save - os.CreateTemp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ratelimiter - LocalRateLimiter - save - tmp.Write: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("ratelimiter - LocalRateLimiter - save - tmp.Close: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("ratelimiter - LocalRateLimiter - save - os.Rename: %w", err)
+	}
+
+	return nil
+}
+
+// restore loads the buckets saved to path, if there is a snapshot. Buckets
+// of another algorithm than the limiter's are dropped, their state wouldn't
+// make sense to it.
+func (rl *LocalRateLimiter) restore(path, algorithm string) (int, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("ratelimiter - LocalRateLimiter - restore - os.ReadFile: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("ratelimiter - LocalRateLimiter - restore - json.Unmarshal: %w", err)
+	}
+
+	if algorithm == "" {
+		algorithm = AlgorithmTokenBucket
+	}
+
+	if snap.Global != nil && snap.Global.Kind == algorithm {
+		rl.globalEntry = snap.Global.entry()
+	}
+
+	now := time.Now()
+	restored := 0
+	for _, s := range snap.Entries {
+		if (s.Kind != algorithm && s.Kind != kindQuota) || now.After(s.Expires) {
+			continue
+		}
+		shard := rl.shard(s.Key)
+		shard.entries[s.Key] = s.entry()
+		restored++
+	}
+
+	return restored, nil
+}
@@ -0,0 +1,116 @@
+package ratelimiter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/pkg/logger"
+)
+
+func newTestSnapshotLimiter(t *testing.T, cfg config.RateLimiter) *LocalRateLimiter {
+	t.Helper()
+
+	rl := NewLocalRateLimiter(cfg, logger.New("debug"))
+	t.Cleanup(rl.Close)
+
+	return rl
+}
+
+func TestLocalRateLimiterSnapshot(t *testing.T) {
+	for _, tc := range algorithmTests {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			cfg := config.RateLimiter{
+				Algorithm:     tc.algorithm,
+				MaxRequests:   100,
+				UserRequests:  5,
+				Interval:      time.Minute,
+				BucketTTL:     time.Minute,
+				CleanInterval: time.Minute,
+				SnapshotFile:  filepath.Join(t.TempDir(), "buckets.json"),
+			}
+			quota := []Quota{{Period: Daily, Requests: 1}}
+
+			rl := newTestSnapshotLimiter(t, cfg)
+			for range 5 {
+				assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+			}
+			assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.2", Quotas: quota}).Allowed)
+			rl.Close()
+
+			// Clients don't get a fresh budget from a restart
+			rl = newTestSnapshotLimiter(t, cfg)
+			assert.False(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+			assert.False(t, rl.Allow(context.Background(), Request{Key: "10.0.0.2", Quotas: quota}).Allowed)
+			assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.3"}).Allowed)
+
+			state, err := rl.Inspect(context.Background(), global)
+			assert.NoError(t, err)
+			assert.Equal(t, 93, state.Remaining)
+		})
+	}
+}
+
+func TestLocalRateLimiterSnapshotAging(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:   100,
+		UserRequests:  5,
+		Interval:      time.Second,
+		BucketTTL:     time.Minute,
+		CleanInterval: time.Minute,
+		SnapshotFile:  filepath.Join(t.TempDir(), "buckets.json"),
+	}
+
+	rl := newTestSnapshotLimiter(t, cfg)
+	for range 5 {
+		assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+	}
+	rl.Close()
+
+	// The bucket refilled while the process was down: one token every 200ms
+	time.Sleep(250 * time.Millisecond)
+	rl = newTestSnapshotLimiter(t, cfg)
+	assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+	assert.False(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+
+	// Buckets that expired while the process was down are dropped
+	cfg.BucketTTL = 50 * time.Millisecond
+	rl = newTestSnapshotLimiter(t, cfg)
+	assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+	rl.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	rl = newTestSnapshotLimiter(t, cfg)
+	_, err := rl.Inspect(context.Background(), "10.0.0.1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestLocalRateLimiterSnapshotMismatch(t *testing.T) {
+	cfg := config.RateLimiter{
+		MaxRequests:   100,
+		UserRequests:  1,
+		Interval:      time.Minute,
+		BucketTTL:     time.Minute,
+		CleanInterval: time.Minute,
+		SnapshotFile:  filepath.Join(t.TempDir(), "buckets.json"),
+	}
+
+	rl := newTestSnapshotLimiter(t, cfg)
+	assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+	rl.Close()
+
+	// Buckets of another algorithm are dropped
+	cfg.Algorithm = AlgorithmGCRA
+	rl = newTestSnapshotLimiter(t, cfg)
+	assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+
+	// A broken snapshot is ignored
+	assert.NoError(t, os.WriteFile(cfg.SnapshotFile, []byte("{"), 0o600))
+	rl = newTestSnapshotLimiter(t, cfg)
+	assert.True(t, rl.Allow(context.Background(), Request{Key: "10.0.0.1"}).Allowed)
+}
@@ -0,0 +1,68 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/ransoor2/ip2country/config"
+)
+
+// Limiter decides whether requests are admitted.
+type Limiter interface {
+	Allow(ctx context.Context, req Request) Decision
+}
+
+// WaitingRateLimiter holds rejected requests until they would be admitted,
+// rather than rejecting them, as long as that takes no more than maxWait.
+// At most maxWaiters requests wait at once; the others are rejected.
+type WaitingRateLimiter struct {
+	limiter Limiter
+	maxWait time.Duration
+	waiters chan struct{}
+}
+
+func NewWaitingRateLimiter(limiter Limiter, cfg config.RateLimiter) *WaitingRateLimiter {
+	return &WaitingRateLimiter{
+		limiter: limiter,
+		maxWait: cfg.MaxWait,
+		waiters: make(chan struct{}, cfg.MaxWaiters),
+	}
+}
+
+// Allow returns the decision of the request once it is admitted, or once it is
+// clear that it won't be within maxWait. Requests costing more than the limit
+// are never admitted and are rejected right away. It stops waiting when ctx is done.
+func (rl *WaitingRateLimiter) Allow(ctx context.Context, req Request) Decision {
+	decision := rl.limiter.Allow(ctx, req)
+	if !waitable(decision, rl.maxWait) {
+		return decision
+	}
+
+	select {
+	case rl.waiters <- struct{}{}:
+		defer func() { <-rl.waiters }()
+	default:
+		return decision
+	}
+
+	deadline := time.Now().Add(rl.maxWait)
+	for waitable(decision, time.Until(deadline)) {
+		timer := time.NewTimer(decision.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return decision
+		case <-timer.C:
+		}
+
+		// Other waiters may have taken the request's turn, in which case it waits again
+		decision = rl.limiter.Allow(ctx, req)
+	}
+
+	return decision
+}
+
+// waitable reports whether a rejected request would be admitted within wait.
+func waitable(decision Decision, wait time.Duration) bool {
+	return !decision.Allowed && !decision.CostExceedsLimit && decision.RetryAfter > 0 && decision.RetryAfter <= wait
+}
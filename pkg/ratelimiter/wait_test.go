@@ -0,0 +1,103 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ransoor2/ip2country/config"
+)
+
+func newTestWaitingRateLimiter(maxWait time.Duration, maxWaiters int) *WaitingRateLimiter {
+	cfg := config.RateLimiter{
+		MaxRequests:   1000,
+		UserRequests:  10,
+		UserBurst:     1,
+		Interval:      time.Second,
+		CleanInterval: time.Minute,
+		BucketTTL:     time.Minute,
+		MaxWait:       maxWait,
+		MaxWaiters:    maxWaiters,
+	}
+
+	return NewWaitingRateLimiter(NewLocalRateLimiter(cfg, nil), cfg)
+}
+
+func TestWaitingRateLimiter(t *testing.T) {
+	rl := newTestWaitingRateLimiter(500*time.Millisecond, 10)
+	req := Request{Key: "192.168.1.1"}
+
+	assert.True(t, rl.Allow(context.Background(), req).Allowed)
+
+	// The next token is 100ms away
+	start := time.Now()
+	assert.True(t, rl.Allow(context.Background(), req).Allowed, "Request should be allowed after waiting")
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestWaitingRateLimiterMaxWait(t *testing.T) {
+	rl := newTestWaitingRateLimiter(50*time.Millisecond, 10)
+	req := Request{Key: "192.168.1.1"}
+
+	assert.True(t, rl.Allow(context.Background(), req).Allowed)
+
+	// Requests that would wait longer than allowed are rejected right away
+	start := time.Now()
+	d := rl.Allow(context.Background(), req)
+	assert.False(t, d.Allowed)
+	assert.Greater(t, d.RetryAfter, 50*time.Millisecond)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestWaitingRateLimiterCostAboveLimit(t *testing.T) {
+	rl := newTestWaitingRateLimiter(2*time.Second, 10)
+
+	// Requests costing more than the burst are never admitted, however long they wait
+	start := time.Now()
+	d := rl.Allow(context.Background(), Request{Key: "192.168.1.1", Cost: 2})
+	assert.False(t, d.Allowed)
+	assert.True(t, d.CostExceedsLimit)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestWaitingRateLimiterCanceled(t *testing.T) {
+	rl := newTestWaitingRateLimiter(time.Second, 10)
+	req := Request{Key: "192.168.1.1"}
+
+	assert.True(t, rl.Allow(context.Background(), req).Allowed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.False(t, rl.Allow(ctx, req).Allowed, "Request should be rejected once canceled")
+	assert.Less(t, time.Since(start), 80*time.Millisecond)
+}
+
+func TestWaitingRateLimiterMaxWaiters(t *testing.T) {
+	rl := newTestWaitingRateLimiter(time.Second, 1)
+	// The first client waits up to a second for its next request
+	first := Request{Key: "192.168.1.1", Limit: &Limit{Requests: 1, Interval: time.Second}}
+	second := Request{Key: "192.168.1.2"}
+
+	assert.True(t, rl.Allow(context.Background(), first).Allowed)
+	assert.True(t, rl.Allow(context.Background(), second).Allowed)
+
+	// A request of the first client takes the only waiting slot
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rl.Allow(ctx, first)
+	}()
+	assert.Eventually(t, func() bool { return len(rl.waiters) == 1 }, time.Second, time.Millisecond)
+
+	// The second client can't wait
+	assert.False(t, rl.Allow(context.Background(), second).Allowed)
+
+	cancel()
+	<-done
+	assert.Empty(t, rl.waiters)
+}
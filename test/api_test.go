@@ -1,8 +1,11 @@
 package test
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -12,15 +15,30 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/apikey"
+	"github.com/ransoor2/ip2country/internal/auth"
+	"github.com/ransoor2/ip2country/internal/controller/http/httpcache"
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
 	v1 "github.com/ransoor2/ip2country/internal/controller/http/v1"
+	"github.com/ransoor2/ip2country/internal/geopolicy"
 	"github.com/ransoor2/ip2country/internal/ip2country"
 	"github.com/ransoor2/ip2country/internal/repositories/disk"
 	"github.com/ransoor2/ip2country/pkg/cache"
+	"github.com/ransoor2/ip2country/pkg/health"
 	"github.com/ransoor2/ip2country/pkg/httpserver"
+	"github.com/ransoor2/ip2country/pkg/ipfilter"
 	"github.com/ransoor2/ip2country/pkg/logger"
 	"github.com/ransoor2/ip2country/pkg/ratelimiter"
 )
 
+const (
+	testAPIKey     = "test-api-key"
+	testAdminToken = "test-admin-token"
+	// testMetricsKey is configured by its SHA-256 digest, with the metrics role
+	testMetricsKey     = "test-metrics-key"
+	testMetricsKeyHash = "c098c85c40d6cf2cd466570e47371a5ec7cfc22c37585e05188869dec452347e"
+)
+
 type APITestSuite struct {
 	suite.Suite
 	client *http.Client
@@ -47,13 +65,51 @@ func (s *APITestSuite) SetupSuite() {
 
 	// Use case
 	ip2CountryService := ip2country.New(repo, l, cacheInst)
+	ip2CountryService.WarmUp(context.Background(), nil)
+
+	// Readiness
+	checker := health.New(cfg.Health.CheckTimeout)
+	checker.Register("repository", ip2CountryService.Ping)
 
 	// Rate Limiter
 	rateLimiter := ratelimiter.NewLocalRateLimiter(cfg.RateLimiter, l)
+	keyer := ratelimiter.NewKeyer(cfg.RateLimiter)
+
+	// API keys
+	cfg.APIKeys.Keys = append(cfg.APIKeys.Keys,
+		config.APIKey{Name: "test", Key: testAPIKey, Tier: "partner"},
+		config.APIKey{Name: "monitoring", Hash: testMetricsKeyHash, Tier: "partner", Roles: []string{"metrics"}},
+	)
+	apiKeys, err := apikey.New(cfg.APIKeys)
+	assert.NoError(s.T(), err)
+
+	// Authentication
+	authenticator, err := auth.New(cfg.Auth, apiKeys, testAdminToken, l)
+	assert.NoError(s.T(), err)
+
+	// IP filter
+	ipFilter, err := ipfilter.New(cfg.IPFilter, l)
+	assert.NoError(s.T(), err)
+
+	// Geo policies
+	cfg.GeoPolicies.Policies = append(cfg.GeoPolicies.Policies,
+		config.GeoPolicy{Name: "embargo", Countries: []string{"Sample Country"}, Action: "block"},
+		config.GeoPolicy{Name: "oceania", Countries: []string{"Australia"}, Action: "limit", Requests: 2, Interval: time.Second},
+	)
+	geoPolicies, err := geopolicy.New(cfg.GeoPolicies)
+	assert.NoError(s.T(), err)
 
 	// HTTP Server
 	handler := gin.New()
-	v1.NewRouter(handler, l, ip2CountryService, rateLimiter)
+	// The test client stands for a proxy on loopback, forwarding the addresses of clients
+	assert.NoError(s.T(), handler.SetTrustedProxies([]string{"127.0.0.1", "::1"}))
+	handler.Use(middleware.AccessLog(cfg.APIKeys.QueryParam))
+	cachePolicy := httpcache.New(cfg.HTTPCache, ip2CountryService, cfg.Auth.Routes.Lookup)
+	inFlight := middleware.NewInFlight(cfg.HTTP.MaxInFlight)
+	v1.NewRouter(handler, l, ip2CountryService, inFlight, rateLimiter, keyer,
+		authenticator, ipFilter, geoPolicies, cachePolicy, cfg.Auth.Routes)
+	v1.NewInternalRouter(handler, authenticator, checker, cfg.Auth.Routes, false)
+	v1.NewAdminRouter(handler, l, rateLimiter, authenticator, cfg.Auth.Routes.Admin)
 
 	s.wg.Add(1)
 	// Run
@@ -108,3 +164,122 @@ func (s *APITestSuite) TestGetCountryNCityByIPInvalidIP() {
 	assert.Empty(s.T(), country)
 	assert.Empty(s.T(), city)
 }
+
+func (s *APITestSuite) TestRateLimitHeaders() {
+	res, err := s.client.Get(baseURI + "?ip=8.8.8.8")
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), "5", res.Header.Get("RateLimit-Limit"))
+	assert.NotEmpty(s.T(), res.Header.Get("RateLimit-Remaining"))
+	assert.NotEmpty(s.T(), res.Header.Get("RateLimit-Reset"))
+	assert.Empty(s.T(), res.Header.Get("Retry-After"))
+}
+
+func (s *APITestSuite) TestAPIKeyTierLimits() {
+	req, err := http.NewRequest(http.MethodGet, baseURI+"?ip=8.8.8.8", http.NoBody)
+	assert.NoError(s.T(), err)
+	req.Header.Set("X-API-Key", testAPIKey)
+
+	res, err := s.client.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), "50", res.Header.Get("RateLimit-Limit"))
+}
+
+func (s *APITestSuite) TestInvalidAPIKey() {
+	res, err := s.client.Get(baseURI + "?ip=8.8.8.8&api_key=unknown")
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+
+	assert.Equal(s.T(), http.StatusUnauthorized, res.StatusCode)
+}
+
+func (s *APITestSuite) TestGeoPolicies() {
+	// Clients are located by their address as forwarded by the trusted proxy, not by the address they look up
+	req, err := http.NewRequest(http.MethodGet, baseURI+"?ip=8.8.8.8", http.NoBody)
+	assert.NoError(s.T(), err)
+	req.Header.Set("X-Forwarded-For", "2.22.233.255")
+
+	res, err := s.client.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+	assert.Equal(s.T(), http.StatusForbidden, res.StatusCode)
+
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	res, err = s.client.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), "2", res.Header.Get("RateLimit-Limit"))
+}
+
+func (s *APITestSuite) TestAdmin() {
+	req, err := http.NewRequest(http.MethodGet, baseURI+"?ip=8.8.8.8", http.NoBody)
+	assert.NoError(s.T(), err)
+	req.Header.Set("X-Forwarded-For", "9.9.9.9")
+	res, err := s.client.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+
+	// The admin endpoints require the admin token
+	res, err = s.client.Get(adminURI + "/keys/9.9.9.9")
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+	assert.Equal(s.T(), http.StatusUnauthorized, res.StatusCode)
+
+	statusCode, body := s.admin(http.MethodGet, "/keys/9.9.9.9", http.NoBody)
+	assert.Equal(s.T(), http.StatusOK, statusCode)
+	var state keyStateResponse
+	assert.NoError(s.T(), json.Unmarshal(body, &state))
+	assert.Equal(s.T(), keyStateResponse{Key: "9.9.9.9", Limit: 5, Remaining: 4}, state)
+
+	statusCode, _ = s.admin(http.MethodDelete, "/keys/9.9.9.9", http.NoBody)
+	assert.Equal(s.T(), http.StatusNoContent, statusCode)
+	statusCode, _ = s.admin(http.MethodGet, "/keys/9.9.9.9", http.NoBody)
+	assert.Equal(s.T(), http.StatusNotFound, statusCode)
+
+	statusCode, body = s.admin(http.MethodPatch, "/limits", strings.NewReader(`{"userRequests": 6}`))
+	assert.Equal(s.T(), http.StatusOK, statusCode)
+	assert.JSONEq(s.T(), `{"maxRequests": 10, "userRequests": 6, "interval": "10s"}`, string(body))
+
+	statusCode, _ = s.admin(http.MethodPatch, "/limits", strings.NewReader(`{"userRequests": 5, "interval": "-1s"}`))
+	assert.Equal(s.T(), http.StatusBadRequest, statusCode)
+
+	statusCode, _ = s.admin(http.MethodPatch, "/limits", strings.NewReader(`{"userRequests": 5}`))
+	assert.Equal(s.T(), http.StatusOK, statusCode)
+}
+
+func (s *APITestSuite) TestMetricsAuthorization() {
+	tests := []struct {
+		name   string
+		key    string
+		status int
+	}{
+		{name: "anonymous", status: http.StatusUnauthorized},
+		{name: "without the metrics role", key: testAPIKey, status: http.StatusForbidden},
+		{name: "with the metrics role", key: testMetricsKey, status: http.StatusOK},
+	}
+
+	// The swagger docs are for operators too
+	for _, uri := range []string{metricsURI, "http://localhost:8080/swagger/index.html"} {
+		for _, tt := range tests {
+			s.Run(tt.name, func() {
+				req, err := http.NewRequest(http.MethodGet, uri, http.NoBody)
+				assert.NoError(s.T(), err)
+				if tt.key != "" {
+					req.Header.Set("X-API-Key", tt.key)
+				}
+
+				res, err := s.client.Do(req)
+				assert.NoError(s.T(), err)
+				defer res.Body.Close()
+				assert.Equal(s.T(), tt.status, res.StatusCode, uri)
+			})
+		}
+	}
+}
@@ -0,0 +1,587 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/ugorji/go/codec"
+
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/apikey"
+	"github.com/ransoor2/ip2country/internal/auth"
+	"github.com/ransoor2/ip2country/internal/controller/http/httpcache"
+	"github.com/ransoor2/ip2country/internal/controller/http/middleware"
+	v1 "github.com/ransoor2/ip2country/internal/controller/http/v1"
+	v2 "github.com/ransoor2/ip2country/internal/controller/http/v2"
+	"github.com/ransoor2/ip2country/internal/geopolicy"
+	"github.com/ransoor2/ip2country/internal/ip2country"
+	"github.com/ransoor2/ip2country/internal/repositories/disk"
+	"github.com/ransoor2/ip2country/pkg/cache"
+	"github.com/ransoor2/ip2country/pkg/health"
+	"github.com/ransoor2/ip2country/pkg/httpserver"
+	"github.com/ransoor2/ip2country/pkg/ipfilter"
+	"github.com/ransoor2/ip2country/pkg/logger"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+const (
+	v2BaseURI    = "http://localhost:8082/v2/ip"
+	adminBaseURI = "http://localhost:8083"
+)
+
+const (
+	testJWTIssuer   = "https://issuer.example.com"
+	testJWTAudience = "ip2country"
+)
+
+type APIv2TestSuite struct {
+	suite.Suite
+	client        *http.Client
+	server        *httpserver.Server
+	adminServer   *httpserver.Server
+	authenticator *auth.Chain
+	checker       *health.Checker
+	jwtKey        *ecdsa.PrivateKey
+	wg            sync.WaitGroup
+}
+
+func (s *APIv2TestSuite) SetupSuite() {
+	s.client = &http.Client{}
+
+	// Configuration
+	os.Setenv("DISK_REPOSITORY_RELATIVE_PATH", "data.json")
+	cfg, err := config.NewConfig("../config/config.yml")
+	assert.NoError(s.T(), err)
+	cfg.HTTP.Port = "8082"
+
+	l := logger.New(cfg.Log.Level)
+	// Cache
+	cacheInst, err := cache.New(cfg.Cache.Size)
+	assert.NoError(s.T(), err)
+
+	// Repository
+	repo, err := disk.New(cfg.DiskRepository.RelativePath)
+	assert.NoError(s.T(), err)
+
+	// Use case
+	ip2CountryService := ip2country.New(repo, l, cacheInst)
+	ip2CountryService.WarmUp(context.Background(), []string{"8.8.8.8"})
+
+	// Readiness
+	s.checker = health.New(cfg.Health.CheckTimeout)
+	s.checker.Register("repository", ip2CountryService.Ping)
+	s.checker.Register("cache", ip2CountryService.WarmedUp)
+
+	// Rate Limiter
+	cfg.RateLimiter.MaxRequests = 100
+	rateLimiter := ratelimiter.NewLocalRateLimiter(cfg.RateLimiter, l)
+	keyer := ratelimiter.NewKeyer(cfg.RateLimiter)
+
+	// API keys
+	apiKeys, err := apikey.New(cfg.APIKeys)
+	assert.NoError(s.T(), err)
+
+	// Authentication, of JWTs signed by the suite's key
+	s.jwtKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(s.T(), err)
+	cfg.Auth.JWT.JWKSFile = filepath.Join(s.T().TempDir(), "jwks.json")
+	cfg.Auth.JWT.Issuer = testJWTIssuer
+	cfg.Auth.JWT.Audience = testJWTAudience
+	writeJWKS(s.T(), s.jwtKey, cfg.Auth.JWT.JWKSFile)
+	s.authenticator, err = auth.New(cfg.Auth, apiKeys, testAdminToken, l)
+	assert.NoError(s.T(), err)
+
+	// IP filter
+	ipFilter, err := ipfilter.New(cfg.IPFilter, l)
+	assert.NoError(s.T(), err)
+
+	// Geo policies
+	geoPolicies, err := geopolicy.New(cfg.GeoPolicies)
+	assert.NoError(s.T(), err)
+
+	// HTTP Server
+	handler := gin.New()
+	// The test client stands for a proxy on loopback, forwarding the addresses of clients
+	assert.NoError(s.T(), handler.SetTrustedProxies([]string{"127.0.0.1", "::1"}))
+	handler.Use(middleware.AccessLog(cfg.APIKeys.QueryParam))
+	cachePolicy := httpcache.New(cfg.HTTPCache, ip2CountryService, cfg.Auth.Routes.Lookup)
+	inFlight := middleware.NewInFlight(cfg.HTTP.MaxInFlight)
+	v1.NewRouter(handler, l, ip2CountryService, inFlight, rateLimiter, keyer,
+		s.authenticator, ipFilter, geoPolicies, cachePolicy, cfg.Auth.Routes)
+	v2.NewRouter(handler, l, ip2CountryService, inFlight, rateLimiter, keyer,
+		s.authenticator, ipFilter, geoPolicies, cachePolicy, cfg.Auth.Routes)
+
+	// Admin listener, serving the routes of operators
+	adminHandler := gin.New()
+	v1.NewInternalRouter(adminHandler, s.authenticator, s.checker, cfg.Auth.Routes, true)
+	v1.NewAdminRouter(adminHandler, l, rateLimiter, s.authenticator, cfg.Auth.Routes.Admin)
+
+	s.wg.Add(1)
+	// Run
+	go func() {
+		defer s.wg.Done()
+		s.server = httpserver.New(handler, httpserver.Port(cfg.HTTP.Port))
+		s.adminServer = httpserver.New(adminHandler, httpserver.Port("8083"))
+	}()
+
+	// Wait for listener to start
+	s.wg.Wait()
+	assert.Eventually(s.T(),
+		func() bool {
+			res, err := s.client.Get(adminBaseURI + "/healthz")
+			if res != nil {
+				defer res.Body.Close()
+			}
+			return err == nil
+		},
+		50*time.Millisecond,
+		10*time.Millisecond,
+	)
+}
+
+func TestAPIv2TestSuite(t *testing.T) {
+	suite.Run(t, new(APIv2TestSuite))
+}
+
+func (s *APIv2TestSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.server.Shutdown())
+	assert.NoError(s.T(), s.adminServer.Shutdown())
+	s.authenticator.Close()
+}
+
+// writeJWKS publishes the public key of the JWTs signed by key to path.
+func writeJWKS(t *testing.T, key *ecdsa.PrivateKey, path string) {
+	t.Helper()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC",
+		"kid": "test",
+		"crv": "P-256",
+		"x":   b64(key.X.FillBytes(make([]byte, 32))),
+		"y":   b64(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, jwks, 0600))
+}
+
+// signJWT returns a JWT of subject with roles, signed by key.
+func signJWT(t *testing.T, key *ecdsa.PrivateKey, subject string, roles ...string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"sub":   subject,
+		"iss":   testJWTIssuer,
+		"aud":   testJWTAudience,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": roles,
+	})
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+
+	return signed
+}
+
+type v2ErrorResponse struct {
+	Error struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	} `json:"error"`
+}
+
+// get requests path of the v2 API from client, and decodes the response into result.
+func (s *APIv2TestSuite) get(path, client string, result any) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, v2BaseURI+path, http.NoBody)
+	assert.NoError(s.T(), err)
+	req.Header.Set("X-Forwarded-For", client)
+
+	res, err := s.client.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+
+	assert.NoError(s.T(), json.NewDecoder(res.Body).Decode(result))
+
+	return res
+}
+
+func (s *APIv2TestSuite) TestLocation() {
+	var result struct {
+		Data map[string]any `json:"data"`
+	}
+	res := s.get("/8.8.8.8", "10.0.0.1", &result)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.NotEmpty(s.T(), res.Header.Get("X-Request-ID"))
+	assert.Equal(s.T(), map[string]any{
+		"ip":           "8.8.8.8",
+		"country":      "United States",
+		"country_code": "US",
+		"region":       "California",
+		"city":         "Mountain View",
+		"latitude":     37.386,
+		"longitude":    -122.0838,
+		"time_zone":    "America/Los_Angeles",
+	}, result.Data)
+
+	// Unknown fields of the record are empty
+	res = s.get("/2.22.233.255", "10.0.0.1", &result)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), "", result.Data["country_code"])
+	assert.Equal(s.T(), "Sample City", result.Data["city"])
+}
+
+func (s *APIv2TestSuite) TestFieldSelection() {
+	var result struct {
+		Data map[string]any `json:"data"`
+	}
+	res := s.get("/1.1.1.1?fields=country_code,city", "10.0.0.2", &result)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), map[string]any{"country_code": "AU", "city": "Research"}, result.Data)
+
+	var errResult v2ErrorResponse
+	res = s.get("/1.1.1.1?fields=country_code,population", "10.0.0.2", &errResult)
+	assert.Equal(s.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Equal(s.T(), "invalid_fields", errResult.Error.Code)
+	assert.Equal(s.T(), `unknown field "population"`, errResult.Error.Message)
+}
+
+func (s *APIv2TestSuite) TestErrors() {
+	for _, tc := range []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/1.2.3.4.5", http.StatusBadRequest, "invalid_ip"},
+		{"/1.2.3.4", http.StatusNotFound, "not_found"},
+		{"/8.8.8.8?api_key=unknown", http.StatusUnauthorized, "unauthorized"},
+	} {
+		var result v2ErrorResponse
+		res := s.get(tc.path, "10.0.0.3", &result)
+		assert.Equal(s.T(), tc.status, res.StatusCode, tc.path)
+		assert.Equal(s.T(), tc.code, result.Error.Code, tc.path)
+		assert.NotEmpty(s.T(), result.Error.Message, tc.path)
+		assert.Equal(s.T(), res.Header.Get("X-Request-ID"), result.Error.RequestID, tc.path)
+	}
+}
+
+func (s *APIv2TestSuite) TestRequestID() {
+	req, err := http.NewRequest(http.MethodGet, v2BaseURI+"/1.2.3.4", http.NoBody)
+	assert.NoError(s.T(), err)
+	req.Header.Set("X-Forwarded-For", "10.0.0.4")
+	req.Header.Set("X-Request-ID", "trace-42")
+
+	res, err := s.client.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+
+	var result v2ErrorResponse
+	assert.NoError(s.T(), json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(s.T(), "trace-42", res.Header.Get("X-Request-ID"))
+	assert.Equal(s.T(), "trace-42", result.Error.RequestID)
+}
+
+func (s *APIv2TestSuite) TestRateLimited() {
+	var result v2ErrorResponse
+	for i := range 6 {
+		res := s.get("/8.8.8.8", "10.0.0.5", &result)
+		if i < 5 {
+			assert.Equal(s.T(), http.StatusOK, res.StatusCode, fmt.Sprintf("request %d", i))
+			continue
+		}
+		assert.Equal(s.T(), http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal(s.T(), "rate_limited", result.Error.Code)
+		assert.NotEmpty(s.T(), res.Header.Get("Retry-After"))
+	}
+}
+
+func (s *APIv2TestSuite) TestV1Unchanged() {
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8082/v1/find-country?ip=8.8.8.8", http.NoBody)
+	assert.NoError(s.T(), err)
+	req.Header.Set("X-Forwarded-For", "10.0.0.6")
+
+	res, err := s.client.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+
+	var result map[string]any
+	assert.NoError(s.T(), json.NewDecoder(res.Body).Decode(&result))
+	assert.Equal(s.T(), map[string]any{"country": "United States", "city": "Mountain View"}, result)
+	assert.Empty(s.T(), res.Header.Get("X-Request-ID"))
+}
+
+// do sends a request to the server from client, and returns the response and its body.
+func (s *APIv2TestSuite) do(method, uri, client string, header http.Header, body io.Reader) (res *http.Response, resBody []byte) {
+	req, err := http.NewRequest(method, uri, body)
+	assert.NoError(s.T(), err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("X-Forwarded-For", client)
+
+	res, err = s.client.Do(req)
+	assert.NoError(s.T(), err)
+	defer res.Body.Close()
+
+	resBody, err = io.ReadAll(res.Body)
+	assert.NoError(s.T(), err)
+
+	return res, resBody
+}
+
+func (s *APIv2TestSuite) TestFormats() {
+	// Shell scripts get just the country code
+	res, body := s.do(http.MethodGet, "http://localhost:8082/v1/find-country?ip=1.1.1.1&format=text", "10.0.1.1", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), "text/plain; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.Equal(s.T(), "AU\n", string(body))
+
+	res, body = s.do(http.MethodGet, v2BaseURI+"/1.1.1.1?fields=country_code,city", "10.0.1.1",
+		http.Header{"Accept": {"text/plain"}}, http.NoBody)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), "AU\tResearch\n", string(body))
+	assert.Contains(s.T(), res.Header.Values("Vary"), "Accept")
+
+	res, body = s.do(http.MethodGet, v2BaseURI+"/1.1.1.1?fields=country_code,city", "10.0.1.1",
+		http.Header{"Accept": {"text/csv"}}, http.NoBody)
+	assert.Equal(s.T(), "text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), [][]string{{"country_code", "city"}, {"AU", "Research"}}, records)
+
+	res, body = s.do(http.MethodGet, v2BaseURI+"/1.1.1.1?format=xml", "10.0.1.1", nil, http.NoBody)
+	assert.Equal(s.T(), "application/xml; charset=utf-8", res.Header.Get("Content-Type"))
+	var xmlResult struct {
+		XMLName     xml.Name `xml:"response"`
+		CountryCode string   `xml:"data>country_code"`
+		Latitude    float64  `xml:"data>latitude"`
+	}
+	assert.NoError(s.T(), xml.Unmarshal(body, &xmlResult))
+	assert.Equal(s.T(), "AU", xmlResult.CountryCode)
+	assert.InDelta(s.T(), -37.7, xmlResult.Latitude, 0.001)
+
+	res, body = s.do(http.MethodGet, v2BaseURI+"/1.1.1.1?fields=city", "10.0.1.1",
+		http.Header{"Accept": {"application/msgpack"}}, http.NoBody)
+	assert.Equal(s.T(), "application/msgpack; charset=utf-8", res.Header.Get("Content-Type"))
+	var msgpackResult map[string]map[string]string
+	assert.NoError(s.T(), codec.NewDecoderBytes(body, new(codec.MsgpackHandle)).Decode(&msgpackResult))
+	assert.Equal(s.T(), map[string]map[string]string{"data": {"city": "Research"}}, msgpackResult)
+
+	// JSON stays the default
+	res, body = s.do(http.MethodGet, v2BaseURI+"/1.1.1.1?fields=city", "10.0.1.6",
+		http.Header{"Accept": {"text/html"}}, http.NoBody)
+	assert.Equal(s.T(), "application/json; charset=utf-8", res.Header.Get("Content-Type"))
+	assert.JSONEq(s.T(), `{"data": {"city": "Research"}}`, string(body))
+}
+
+func (s *APIv2TestSuite) TestErrorFormats() {
+	res, body := s.do(http.MethodGet, v2BaseURI+"/1.2.3.4?format=xml", "10.0.1.2", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusNotFound, res.StatusCode)
+	var xmlResult struct {
+		Code      string `xml:"error>code"`
+		RequestID string `xml:"error>request_id"`
+	}
+	assert.NoError(s.T(), xml.Unmarshal(body, &xmlResult))
+	assert.Equal(s.T(), "not_found", xmlResult.Code)
+	assert.Equal(s.T(), res.Header.Get("X-Request-ID"), xmlResult.RequestID)
+
+	res, body = s.do(http.MethodGet, v2BaseURI+"/1.2.3.4", "10.0.1.2", http.Header{"Accept": {"text/plain"}}, http.NoBody)
+	assert.Equal(s.T(), http.StatusNotFound, res.StatusCode)
+	assert.Equal(s.T(), "not_found: location not found\n", string(body))
+
+	res, body = s.do(http.MethodGet, "http://localhost:8082/v1/find-country?ip=1.2.3.4.5&format=csv", "10.0.1.2", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Equal(s.T(), "error\ninvalid IP address format\n", string(body))
+
+	// Unknown formats are rejected in JSON
+	res, body = s.do(http.MethodGet, v2BaseURI+"/1.1.1.1?format=yaml", "10.0.1.2", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusNotAcceptable, res.StatusCode)
+	var result v2ErrorResponse
+	assert.NoError(s.T(), json.Unmarshal(body, &result))
+	assert.Equal(s.T(), "not_acceptable", result.Error.Code)
+}
+
+func (s *APIv2TestSuite) TestBatch() {
+	batch := `{"ips": ["8.8.8.8", "1.2.3.4", "1.2.3.4.5"]}`
+	res, body := s.do(http.MethodPost, v2BaseURI+"/batch?fields=country_code", "10.0.1.3", nil, strings.NewReader(batch))
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), "2", res.Header.Get("RateLimit-Remaining"))
+	assert.JSONEq(s.T(), `{"data": [
+		{"ip": "8.8.8.8", "data": {"country_code": "US"}},
+		{"ip": "1.2.3.4", "error": {"code": "not_found", "message": "location not found"}},
+		{"ip": "1.2.3.4.5", "error": {"code": "invalid_ip", "message": "invalid IP address format"}}
+	]}`, string(body))
+
+	res, body = s.do(http.MethodPost, v2BaseURI+"/batch?fields=country_code,city&format=csv", "10.0.1.4", nil, strings.NewReader(batch))
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), [][]string{
+		{"ip", "country_code", "city", "error"},
+		{"8.8.8.8", "US", "Mountain View", ""},
+		{"1.2.3.4", "", "", "not_found"},
+		{"1.2.3.4.5", "", "", "invalid_ip"},
+	}, records)
+
+	res, _ = s.do(http.MethodPost, v2BaseURI+"/batch", "10.0.1.5", nil, strings.NewReader(`{"ips": []}`))
+	assert.Equal(s.T(), http.StatusBadRequest, res.StatusCode)
+
+	// Oversized batches are rejected before they are charged
+	tooMany := `{"ips": ["8.8.8.8"` + strings.Repeat(`, "8.8.8.8"`, 1000) + `]}`
+	res, _ = s.do(http.MethodPost, v2BaseURI+"/batch", "10.0.1.6", nil, strings.NewReader(tooMany))
+	assert.Equal(s.T(), http.StatusBadRequest, res.StatusCode)
+	tooLarge := `{"ips": ["` + strings.Repeat(" ", 64<<10) + `"]}`
+	res, _ = s.do(http.MethodPost, v2BaseURI+"/batch", "10.0.1.6", nil, strings.NewReader(tooLarge))
+	assert.Equal(s.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Equal(s.T(), "3", res.Header.Get("RateLimit-Remaining"))
+
+	// Batches costing more than the limit are never admitted, so retrying them is pointless
+	var errResp v2ErrorResponse
+	overLimit := `{"ips": ["8.8.8.8"` + strings.Repeat(`, "8.8.8.8"`, 100) + `]}`
+	res, body = s.do(http.MethodPost, v2BaseURI+"/batch", "10.0.1.7", nil, strings.NewReader(overLimit))
+	assert.Equal(s.T(), http.StatusBadRequest, res.StatusCode)
+	assert.Empty(s.T(), res.Header.Get("Retry-After"))
+	assert.NoError(s.T(), json.Unmarshal(body, &errResp))
+	assert.Equal(s.T(), "invalid_request", errResp.Error.Code)
+	assert.Contains(s.T(), errResp.Error.Message, "more than the limit")
+}
+
+func (s *APIv2TestSuite) TestConditionalGet() {
+	for _, uri := range []string{
+		"http://localhost:8082/v1/find-country?ip=8.8.8.8",
+		v2BaseURI + "/8.8.8.8?fields=city",
+	} {
+		res, _ := s.do(http.MethodGet, uri, "10.0.2.1", nil, http.NoBody)
+		assert.Equal(s.T(), http.StatusOK, res.StatusCode, uri)
+		assert.Equal(s.T(), "public, max-age=3600", res.Header.Get("Cache-Control"), uri)
+		etag := res.Header.Get("ETag")
+		assert.NotEmpty(s.T(), etag, uri)
+		assert.Equal(s.T(), []string{"Accept"}, res.Header.Values("Vary"), uri)
+
+		res, body := s.do(http.MethodGet, uri, "10.0.2.2", http.Header{"If-None-Match": {etag}}, http.NoBody)
+		assert.Equal(s.T(), http.StatusNotModified, res.StatusCode, uri)
+		assert.Empty(s.T(), body, uri)
+		assert.Equal(s.T(), etag, res.Header.Get("ETag"), uri)
+		assert.Equal(s.T(), "public, max-age=3600", res.Header.Get("Cache-Control"), uri)
+
+		// Other representations have their own ETag
+		res, _ = s.do(http.MethodGet, uri, "10.0.2.3", http.Header{"If-None-Match": {etag}, "Accept": {"text/csv"}}, http.NoBody)
+		assert.Equal(s.T(), http.StatusOK, res.StatusCode, uri)
+		assert.NotEqual(s.T(), etag, res.Header.Get("ETag"), uri)
+
+		// Responses selected by the format parameter don't vary by Accept
+		res, _ = s.do(http.MethodGet, uri+"&format=xml", "10.0.2.4", nil, http.NoBody)
+		assert.Equal(s.T(), http.StatusOK, res.StatusCode, uri)
+		assert.Empty(s.T(), res.Header.Values("Vary"), uri)
+	}
+
+	// Errors aren't cached
+	res, _ := s.do(http.MethodGet, v2BaseURI+"/1.2.3.4", "10.0.2.5", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusNotFound, res.StatusCode)
+	assert.Empty(s.T(), res.Header.Get("ETag"))
+	assert.Empty(s.T(), res.Header.Get("Cache-Control"))
+}
+
+func (s *APIv2TestSuite) TestJWT() {
+	header := http.Header{"Authorization": {"Bearer " + signJWT(s.T(), s.jwtKey, "alice")}}
+	res, _ := s.do(http.MethodGet, v2BaseURI+"/8.8.8.8", "198.51.100.30", header, http.NoBody)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), "5", res.Header.Get("RateLimit-Limit"))
+	assert.Equal(s.T(), "4", res.Header.Get("RateLimit-Remaining"))
+
+	// The principal is limited wherever it calls from
+	res, _ = s.do(http.MethodGet, v2BaseURI+"/8.8.8.8", "198.51.100.31", header, http.NoBody)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.Equal(s.T(), "3", res.Header.Get("RateLimit-Remaining"))
+
+	var errResp v2ErrorResponse
+	header.Set("Authorization", "Bearer "+signJWT(s.T(), s.jwtKey, "alice")+"x")
+	res, body := s.do(http.MethodGet, v2BaseURI+"/8.8.8.8", "198.51.100.32", header, http.NoBody)
+	assert.Equal(s.T(), http.StatusUnauthorized, res.StatusCode)
+	assert.NoError(s.T(), json.Unmarshal(body, &errResp))
+	assert.Equal(s.T(), "unauthorized", errResp.Error.Code)
+}
+
+func (s *APIv2TestSuite) TestAdminListener() {
+	adminToken := http.Header{"Authorization": {"Bearer " + testAdminToken}}
+
+	// The routes of operators are not exposed on the public port
+	for _, path := range []string{"/healthz", "/metrics", "/debug/pprof/", "/admin/ratelimiter/limits"} {
+		res, _ := s.do(http.MethodGet, "http://localhost:8082"+path, "198.51.100.40", adminToken, http.NoBody)
+		assert.Equal(s.T(), http.StatusNotFound, res.StatusCode, path)
+	}
+
+	// Nor are the swagger docs to clients without the metrics role
+	for _, path := range []string{"/swagger/index.html", "/v2/swagger/index.html"} {
+		res, _ := s.do(http.MethodGet, "http://localhost:8082"+path, "198.51.100.40", nil, http.NoBody)
+		assert.Equal(s.T(), http.StatusUnauthorized, res.StatusCode, path)
+		res, _ = s.do(http.MethodGet, "http://localhost:8082"+path, "198.51.100.40", adminToken, http.NoBody)
+		assert.Equal(s.T(), http.StatusForbidden, res.StatusCode, path)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		status int
+	}{
+		{name: "probe", path: "/healthz", status: http.StatusOK},
+		{name: "metrics without the metrics role", path: "/metrics", header: adminToken, status: http.StatusForbidden},
+		{name: "admin", path: "/admin/ratelimiter/limits", header: adminToken, status: http.StatusOK},
+		{name: "pprof anonymously", path: "/debug/pprof/", status: http.StatusUnauthorized},
+		{name: "pprof index", path: "/debug/pprof/", header: adminToken, status: http.StatusOK},
+		{name: "pprof profile", path: "/debug/pprof/heap?debug=1", header: adminToken, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			res, _ := s.do(http.MethodGet, adminBaseURI+tt.path, "198.51.100.41", tt.header, http.NoBody)
+			assert.Equal(s.T(), tt.status, res.StatusCode)
+		})
+	}
+}
+
+func (s *APIv2TestSuite) TestReadiness() {
+	var report health.Report
+	res, body := s.do(http.MethodGet, adminBaseURI+"/readyz", "198.51.100.42", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	assert.NoError(s.T(), json.Unmarshal(body, &report))
+	assert.Equal(s.T(), health.StatusOK, report.Status)
+	assert.Equal(s.T(), health.StatusOK, report.Checks["repository"].Status)
+	assert.Equal(s.T(), health.StatusOK, report.Checks["cache"].Status)
+
+	res, _ = s.do(http.MethodGet, adminBaseURI+"/livez", "198.51.100.42", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+
+	// Draining fails readiness only, requests are still served. No test probes readiness after this one.
+	s.checker.Drain()
+	res, body = s.do(http.MethodGet, adminBaseURI+"/readyz", "198.51.100.42", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusServiceUnavailable, res.StatusCode)
+	assert.NoError(s.T(), json.Unmarshal(body, &report))
+	assert.Equal(s.T(), health.StatusDraining, report.Status)
+
+	res, _ = s.do(http.MethodGet, adminBaseURI+"/livez", "198.51.100.42", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	res, _ = s.do(http.MethodGet, v2BaseURI+"/8.8.8.8", "198.51.100.42", nil, http.NoBody)
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+}
@@ -0,0 +1,180 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	pb "github.com/ransoor2/ip2country/api/proto/v1"
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/app"
+)
+
+func newAppConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	os.Setenv("DISK_REPOSITORY_RELATIVE_PATH", "data.json")
+	cfg, err := config.NewConfig("../config/config.yml")
+	assert.NoError(t, err)
+	cfg.HTTP.Port = "8084"
+	cfg.GRPC.Port = "8085"
+	cfg.Admin.Port = "8086"
+	cfg.Health.ShutdownDelay = 0
+
+	return cfg
+}
+
+func TestApp(t *testing.T) {
+	a, err := app.New(newAppConfig(t))
+	assert.NoError(t, err)
+	assert.NoError(t, a.Start(context.Background()))
+
+	res, err := http.Get("http://localhost:8084/v1/find-country?ip=8.8.8.8")
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+	assert.Eventually(t, func() bool {
+		res, err := http.Get("http://localhost:8086/readyz")
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(t, a.Stop(ctx))
+	assert.NoError(t, a.Stop(ctx))
+
+	// The ports are released
+	for _, port := range []string{"8084", "8085", "8086"} {
+		ln, err := net.Listen("tcp", ":"+port)
+		if assert.NoError(t, err, port) {
+			ln.Close()
+		}
+	}
+}
+
+func TestAppDrain(t *testing.T) {
+	cfg := newAppConfig(t)
+	cfg.Health.ShutdownDelay = 500 * time.Millisecond
+	a, err := app.New(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, a.Start(context.Background()))
+
+	conn, err := grpc.NewClient("localhost:8085", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	healthClient := healthpb.NewHealthClient(conn)
+	check := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := healthClient.Check(context.Background(), &healthpb.HealthCheckRequest{Service: pb.IP2Country_ServiceDesc.ServiceName})
+		if err != nil {
+			return healthpb.HealthCheckResponse_UNKNOWN
+		}
+		return resp.GetStatus()
+	}
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check())
+
+	stopped := make(chan error)
+	go func() { stopped <- a.Stop(context.Background()) }()
+
+	// gRPC clients are told to go elsewhere while the servers keep serving
+	assert.Eventually(t, func() bool {
+		return check() == healthpb.HealthCheckResponse_NOT_SERVING
+	}, 400*time.Millisecond, 10*time.Millisecond)
+	assert.NoError(t, <-stopped)
+}
+
+func TestAppInProcess(t *testing.T) {
+	a, err := app.New(newAppConfig(t))
+	assert.NoError(t, err)
+	defer a.Stop(context.Background())
+
+	// Served without listening
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/find-country?ip=8.8.8.8", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	a.InternalHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAppTrustedProxies(t *testing.T) {
+	lookup := func(a *app.App, remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/find-country?ip=8.8.8.8", http.NoBody)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Clients can't pick their address: those rotating it share the bucket of their connection
+	a, err := app.New(newAppConfig(t))
+	assert.NoError(t, err)
+	defer a.Stop(context.Background())
+	for i := range 5 {
+		assert.Equal(t, http.StatusOK, lookup(a, "192.0.2.1:1234", fmt.Sprintf("198.51.100.%d", i)))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, lookup(a, "192.0.2.1:1234", "198.51.100.5"))
+
+	// Unless they connect through a trusted proxy
+	cfg := newAppConfig(t)
+	cfg.HTTP.TrustedProxies = []string{"192.0.2.0/24"}
+	a, err = app.New(cfg)
+	assert.NoError(t, err)
+	defer a.Stop(context.Background())
+	for i := range 6 {
+		assert.Equal(t, http.StatusOK, lookup(a, "192.0.2.1:1234", fmt.Sprintf("198.51.100.%d", i)))
+	}
+}
+
+func TestAppErrors(t *testing.T) {
+	// Invalid components are reported rather than exiting
+	cfg := newAppConfig(t)
+	cfg.Repository.Type = "unknown"
+	_, err := app.New(cfg)
+	assert.ErrorContains(t, err, "unknown repository type")
+
+	// Failed constructors are not closed, the components built before them are
+	cfg = newAppConfig(t)
+	cfg.Repository.Type = "mongo"
+	cfg.MongoRepository.URI = "bogus://x"
+	_, err = app.New(cfg)
+	assert.ErrorContains(t, err, "initializeRepository")
+
+	cfg = newAppConfig(t)
+	cfg.RateLimiter.Type = "distributed"
+	cfg.RateLimiter.RedisTLS = true
+	cfg.RateLimiter.RedisCAFile = "missing-ca.pem"
+	_, err = app.New(cfg)
+	assert.ErrorContains(t, err, "getRateLimiter")
+
+	// So are ports in use, and the servers that started are stopped
+	ln, err := net.Listen("tcp", ":8086")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	a, err := app.New(newAppConfig(t))
+	assert.NoError(t, err)
+	assert.ErrorContains(t, a.Start(context.Background()), "adminServer")
+	assert.NoError(t, a.Stop(context.Background()))
+
+	ln, err = net.Listen("tcp", ":8084")
+	if assert.NoError(t, err) {
+		ln.Close()
+	}
+}
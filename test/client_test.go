@@ -3,12 +3,16 @@ package test
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 
 	"github.com/stretchr/testify/assert"
 )
 
 const (
-	baseURI = "http://localhost:8080/v1/find-country"
+	baseURI    = "http://localhost:8080/v1/find-country"
+	adminURI   = "http://localhost:8080/admin/ratelimiter"
+	metricsURI = "http://localhost:8080/metrics"
 )
 
 type findCountryResponse struct {
@@ -33,3 +37,25 @@ func (s *APITestSuite) getCountryNCityByIP(ip string) (country, city string, sta
 
 	return result.Country, result.City, statusCode, nil
 }
+
+type keyStateResponse struct {
+	Key       string `json:"key"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+}
+
+// admin sends an admin request with the test token, and returns the response status and body.
+func (s *APITestSuite) admin(method, path string, body io.Reader) (statusCode int, respBody []byte) {
+	req, err := http.NewRequest(method, adminURI+path, body)
+	assert.NoError(s.T(), err)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	response, err := s.client.Do(req)
+	assert.NoError(s.T(), err)
+	defer response.Body.Close()
+
+	respBody, err = io.ReadAll(response.Body)
+	assert.NoError(s.T(), err)
+
+	return response.StatusCode, respBody
+}
@@ -0,0 +1,270 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/ransoor2/ip2country/api/proto/v1"
+	"github.com/ransoor2/ip2country/config"
+	"github.com/ransoor2/ip2country/internal/apikey"
+	"github.com/ransoor2/ip2country/internal/auth"
+	grpcv1 "github.com/ransoor2/ip2country/internal/controller/grpc/v1"
+	"github.com/ransoor2/ip2country/internal/geopolicy"
+	"github.com/ransoor2/ip2country/internal/ip2country"
+	"github.com/ransoor2/ip2country/internal/repositories/disk"
+	"github.com/ransoor2/ip2country/pkg/cache"
+	"github.com/ransoor2/ip2country/pkg/grpcserver"
+	"github.com/ransoor2/ip2country/pkg/ipfilter"
+	"github.com/ransoor2/ip2country/pkg/logger"
+	"github.com/ransoor2/ip2country/pkg/ratelimiter"
+)
+
+const grpcAddr = "localhost:8081"
+
+type GRPCTestSuite struct {
+	suite.Suite
+	conn   *grpc.ClientConn
+	client pb.IP2CountryClient
+	server *grpcserver.Server
+}
+
+func (s *GRPCTestSuite) SetupSuite() {
+	// Configuration
+	os.Setenv("DISK_REPOSITORY_RELATIVE_PATH", "data.json")
+	cfg, err := config.NewConfig("../config/config.yml")
+	assert.NoError(s.T(), err)
+
+	l := logger.New(cfg.Log.Level)
+	// Cache
+	cacheInst, err := cache.New(cfg.Cache.Size)
+	assert.NoError(s.T(), err)
+
+	// Repository
+	repo, err := disk.New(cfg.DiskRepository.RelativePath)
+	assert.NoError(s.T(), err)
+
+	// Use case
+	ip2CountryService := ip2country.New(repo, l, cacheInst)
+
+	// Rate Limiter
+	cfg.RateLimiter.MaxRequests = 100
+	cfg.RateLimiter.UserRequests = 20
+	rateLimiter := ratelimiter.NewLocalRateLimiter(cfg.RateLimiter, l)
+	keyer := ratelimiter.NewKeyer(cfg.RateLimiter)
+
+	// API keys
+	apiKeys, err := apikey.New(cfg.APIKeys)
+	assert.NoError(s.T(), err)
+
+	// Authentication
+	authenticator, err := auth.New(cfg.Auth, apiKeys, testAdminToken, l)
+	assert.NoError(s.T(), err)
+
+	// IP filter
+	ipFilter, err := ipfilter.New(cfg.IPFilter, l)
+	assert.NoError(s.T(), err)
+
+	// Geo policies
+	geoPolicies, err := geopolicy.New(cfg.GeoPolicies)
+	assert.NoError(s.T(), err)
+
+	// gRPC Server
+	router := grpcv1.NewRouter(l, grpchealth.NewServer(), ip2CountryService, rateLimiter, keyer,
+		authenticator, cfg.Auth.Routes.Lookup, ipFilter, geoPolicies)
+	s.server = grpcserver.New(router, grpcserver.Port(cfg.GRPC.Port))
+
+	s.conn, err = grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(s.T(), err)
+	s.client = pb.NewIP2CountryClient(s.conn)
+
+	// Wait for listener to start
+	health := healthpb.NewHealthClient(s.conn)
+	assert.Eventually(s.T(),
+		func() bool {
+			_, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+			return err == nil
+		},
+		time.Second,
+		10*time.Millisecond,
+	)
+}
+
+func TestGRPCTestSuite(t *testing.T) {
+	suite.Run(t, new(GRPCTestSuite))
+}
+
+func (s *GRPCTestSuite) TearDownSuite() {
+	assert.NoError(s.T(), s.conn.Close())
+	s.server.Shutdown()
+}
+
+func (s *GRPCTestSuite) TestLookup() {
+	var header metadata.MD
+	resp, err := s.client.Lookup(context.Background(), &pb.LookupRequest{Ip: "2.22.233.255"}, grpc.Header(&header))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "Sample Country", resp.GetCountry())
+	assert.Equal(s.T(), "Sample City", resp.GetCity())
+	assert.Equal(s.T(), []string{"20"}, header.Get("ratelimit-limit"))
+
+	_, err = s.client.Lookup(context.Background(), &pb.LookupRequest{Ip: "1.2.3.4"})
+	assert.Equal(s.T(), codes.NotFound, status.Code(err))
+
+	_, err = s.client.Lookup(context.Background(), &pb.LookupRequest{Ip: "1.2.3.4.5"})
+	assert.Equal(s.T(), codes.InvalidArgument, status.Code(err))
+}
+
+func (s *GRPCTestSuite) TestBatchLookup() {
+	resp, err := s.client.BatchLookup(context.Background(), &pb.BatchLookupRequest{Ips: []string{"8.8.8.8", "1.2.3.4.5"}})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), resp.GetResults(), 2)
+	assert.Equal(s.T(), "United States", resp.GetResults()[0].GetCountry())
+	assert.Nil(s.T(), resp.GetResults()[0].GetError())
+	assert.Equal(s.T(), int32(codes.InvalidArgument), resp.GetResults()[1].GetError().GetCode())
+
+	// Batches cost a request per address, and those costing more than the
+	// burst can never be admitted
+	var trailer metadata.MD
+	_, err = s.client.BatchLookup(context.Background(), &pb.BatchLookupRequest{Ips: make([]string, 21)}, grpc.Trailer(&trailer))
+	assert.Equal(s.T(), codes.InvalidArgument, status.Code(err))
+	assert.Empty(s.T(), trailer.Get("retry-after"))
+
+	_, err = s.client.BatchLookup(context.Background(), &pb.BatchLookupRequest{Ips: make([]string, 20)}, grpc.Trailer(&trailer))
+	assert.Equal(s.T(), codes.ResourceExhausted, status.Code(err))
+	assert.NotEmpty(s.T(), trailer.Get("retry-after"))
+
+	// Oversized batches are rejected before they are charged
+	_, err = s.client.BatchLookup(context.Background(), &pb.BatchLookupRequest{Ips: make([]string, 1001)})
+	assert.Equal(s.T(), codes.InvalidArgument, status.Code(err))
+}
+
+func (s *GRPCTestSuite) TestStreamLookup() {
+	stream, err := s.client.StreamLookup(context.Background())
+	assert.NoError(s.T(), err)
+
+	for _, ip := range []string{"1.1.1.1", "1.2.3.4"} {
+		assert.NoError(s.T(), stream.Send(&pb.LookupRequest{Ip: ip}))
+	}
+	assert.NoError(s.T(), stream.CloseSend())
+
+	var results []*pb.LookupResult
+	for {
+		result, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(s.T(), err)
+		results = append(results, result)
+	}
+
+	assert.Len(s.T(), results, 2)
+	assert.Equal(s.T(), "Australia", results[0].GetCountry())
+	assert.Equal(s.T(), int32(codes.NotFound), results[1].GetError().GetCode())
+}
+
+func (s *GRPCTestSuite) TestInvalidAPIKey() {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "unknown")
+	_, err := s.client.Lookup(ctx, &pb.LookupRequest{Ip: "8.8.8.8"})
+	assert.Equal(s.T(), codes.Unauthenticated, status.Code(err))
+}
+
+func (s *GRPCTestSuite) TestHealth() {
+	resp, err := healthpb.NewHealthClient(s.conn).Check(context.Background(),
+		&healthpb.HealthCheckRequest{Service: pb.IP2Country_ServiceDesc.ServiceName})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+}
+
+func TestGRPCAuthorization(t *testing.T) {
+	os.Setenv("DISK_REPOSITORY_RELATIVE_PATH", "data.json")
+	cfg, err := config.NewConfig("../config/config.yml")
+	assert.NoError(t, err)
+
+	l := logger.New(cfg.Log.Level)
+	repo, err := disk.New(cfg.DiskRepository.RelativePath)
+	assert.NoError(t, err)
+	cacheInst, err := cache.New(cfg.Cache.Size)
+	assert.NoError(t, err)
+	ip2CountryService := ip2country.New(repo, l, cacheInst)
+
+	// Lookups require the lookup role, granted by JWTs signed by the test key
+	cfg.APIKeys.Keys = append(cfg.APIKeys.Keys, config.APIKey{Name: "test", Key: testAPIKey, Tier: "partner"})
+	apiKeys, err := apikey.New(cfg.APIKeys)
+	assert.NoError(t, err)
+	jwtKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	cfg.Auth.JWT.JWKSFile = filepath.Join(t.TempDir(), "jwks.json")
+	cfg.Auth.JWT.Issuer = testJWTIssuer
+	cfg.Auth.JWT.Audience = testJWTAudience
+	writeJWKS(t, jwtKey, cfg.Auth.JWT.JWKSFile)
+	authenticator, err := auth.New(cfg.Auth, apiKeys, testAdminToken, l)
+	assert.NoError(t, err)
+	defer authenticator.Close()
+
+	ipFilter, err := ipfilter.New(cfg.IPFilter, l)
+	assert.NoError(t, err)
+	geoPolicies, err := geopolicy.New(cfg.GeoPolicies)
+	assert.NoError(t, err)
+
+	router := grpcv1.NewRouter(l, grpchealth.NewServer(), ip2CountryService, ratelimiter.NewLocalRateLimiter(cfg.RateLimiter, l),
+		ratelimiter.NewKeyer(cfg.RateLimiter), authenticator, "lookup", ipFilter, geoPolicies)
+	server := grpcserver.New(router, grpcserver.Port("8087"))
+	defer server.Shutdown()
+
+	conn, err := grpc.NewClient("localhost:8087", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewIP2CountryClient(conn)
+
+	tests := []struct {
+		name string
+		md   []string
+		code codes.Code
+	}{
+		{name: "anonymous", code: codes.Unauthenticated},
+		{name: "invalid token", md: []string{"authorization", "Bearer invalid"}, code: codes.Unauthenticated},
+		{name: "API key without the role", md: []string{"x-api-key", testAPIKey}, code: codes.PermissionDenied},
+		{name: "JWT without the role", md: []string{"authorization", "Bearer " + signJWT(t, jwtKey, "alice")}, code: codes.PermissionDenied},
+		{name: "JWT with the role", md: []string{"authorization", "Bearer " + signJWT(t, jwtKey, "bob", "lookup")}, code: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tt.md...)
+			_, err := client.Lookup(ctx, &pb.LookupRequest{Ip: "8.8.8.8"})
+			assert.Equal(t, tt.code, status.Code(err))
+
+			// Streams are authorized when they open
+			stream, err := client.StreamLookup(ctx)
+			assert.NoError(t, err)
+			assert.NoError(t, stream.CloseSend())
+			_, err = stream.Recv()
+			if tt.code == codes.OK {
+				assert.ErrorIs(t, err, io.EOF)
+				return
+			}
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+
+	// Health checks stay open to probes
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+}